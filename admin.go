@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// recomputeHandler rebuilds the running statistics, globally and per city,
+// geohash and currency bucket, and the rolling median, from the transactions
+// still in the queue. It is a recovery tool for aggregates that have drifted
+// from the queue.
+func recomputeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statsCache.lock.Lock()
+	defer statsCache.lock.Unlock()
+
+	if statsCache.sampling() {
+		http.Error(w, "Cannot recompute while the queue is sampled", http.StatusConflict)
+		return
+	}
+
+	now := clock()
+	statsCache.evict(now)
+
+	// Transactions with their own TTL stay in ttlQueue alone.
+	live := statsCache.filter(now, func(t *Transaction) bool { return t.ttl == 0 })
+
+	before := statsCache.stats
+	statsCache.stats = aggregate(live)
+
+	// Retained transactions older than the window stay queued but no
+	// longer count towards Sum.
+	statsCache.cityCache.clear()
+	statsCache.sumOffset = 0
+	for _, t := range statsCache.queue {
+		if t.expired(now) || t.ttl > 0 {
+			statsCache.sumOffset -= t.Amount
+		}
+	}
+
+	cities := statsCache.cities
+	geohashes := statsCache.geohashes
+	currencies := statsCache.currencies
+	statsCache.cities = nil
+	statsCache.geohashes = nil
+	statsCache.currencies = nil
+	for _, t := range live {
+		if t.city != "" {
+			statsCache.cities = addToBucket(statsCache.cities, t.city, t, lastUpdated(cities, t.city, now))
+		}
+		if t.geohash != "" {
+			statsCache.geohashes = addToBucket(statsCache.geohashes, t.geohash, t, lastUpdated(geohashes, t.geohash, now))
+		}
+		if config.CurrencyStats && t.Currency != "" {
+			statsCache.currencies = addToBucket(statsCache.currencies, t.Currency, t, lastUpdated(currencies, t.Currency, now))
+		}
+	}
+
+	// The median covers transactions with a TTL too, as it did when they
+	// were accepted.
+	if config.Median {
+		statsCache.median.reset()
+		for _, t := range statsCache.filter(now, func(*Transaction) bool { return true }) {
+			statsCache.median.add(t, now)
+		}
+	}
+
+	logf(r, "recompute: before %+v, after %+v", before, statsCache.stats)
+
+	encodeStats(w, r, statsCache.current(now))
+}
+
+// lastUpdated returns when the bucket for key was last updated, or def if
+// there is no such bucket.
+func lastUpdated(buckets map[string]*StatsBucket, key string, def time.Time) time.Time {
+	if bucket, ok := buckets[key]; ok {
+		return bucket.lastUpdated
+	}
+	return def
+}
+
+// maxWindow bounds the windows accepted by /admin/config/window.
+const maxWindow = time.Hour * 24
+
+type WindowConfig struct {
+	Window string `json:"window"`
+}
+
+// windowConfigHandler changes the statistics window at runtime. Shrinking
+// the window below the retention period keeps older transactions queued,
+// but otherwise evicts those outside the new window straight away; they are
+// not restored if the window grows again.
+func windowConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body WindowConfig
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	d, err := time.ParseDuration(body.Window)
+	if err != nil || d <= 0 || d > maxWindow {
+		http.Error(w, "Window must be a duration between 0 and 24h", http.StatusUnprocessableEntity)
+		return
+	}
+
+	statsCache.lock.Lock()
+	defer statsCache.lock.Unlock()
+
+	previous := statsWindow()
+	window.Store(int64(d))
+	statsCache.evict(clock())
+	statsCache.cityCache.clear()
+
+	logf(r, "window changed from %v to %v", previous, d)
+	auditNote(r, "window %v to %v", previous, d)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redacted replaces the value of a secret in /admin/config.
+const redacted = "[redacted]"
+
+// secretFields are the Config fields /admin/config never shows.
+var secretFields = []string{"APIKey", "CookieSecret", "WebhookURL"}
+
+// configHandler reports the effective configuration, including settings
+// changed at runtime. Secrets, listed under "Redacted", are replaced by
+// "[redacted]" when set and are empty otherwise.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	view := make(map[string]any)
+	v := reflect.ValueOf(config)
+	for i := range v.NumField() {
+		name, value := v.Type().Field(i).Name, v.Field(i).Interface()
+		if slices.Contains(secretFields, name) {
+			if v.Field(i).String() != "" {
+				value = redacted
+			}
+		}
+		view[name] = configValue(value)
+	}
+	view["Window"] = statsWindow().String()
+	view["AuthEnabled"] = config.APIKey != ""
+	view["SessionsEnabled"] = config.CookieSecret != ""
+	view["AuthorizedCities"] = authorizedCities
+	view["Redacted"] = secretFields
+
+	json.NewEncoder(w).Encode(view)
+}
+
+// configValue spells durations the way they are configured.
+func configValue(value any) any {
+	switch value := value.(type) {
+	case time.Duration:
+		return value.String()
+	case Rate:
+		return value.String()
+	case map[string]time.Duration:
+		m := make(map[string]string, len(value))
+		for k, d := range value {
+			m[k] = d.String()
+		}
+		return m
+	}
+	return value
+}
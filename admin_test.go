@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRecompute(t *testing.T) {
+	setup(t, "API_KEY=secret", "MEDIAN=true")
+	setCity(t, "bangalore")
+	for _, amount := range []string{"10", "20", "30"} {
+		post(t, tx(amount, testStart), http.StatusCreated)
+	}
+
+	// Drift the aggregates away from the queue.
+	statsCache.lock.Lock()
+	statsCache.stats.Sum += 1000
+	statsCache.stats.Max = 1000
+	statsCache.cities["bangalore"].stats.Count = 7
+	statsCache.median.add(&Transaction{Amount: 1000, Timestamp: testStart}, testStart)
+	statsCache.median.add(&Transaction{Amount: 1000, Timestamp: testStart}, testStart)
+	statsCache.lock.Unlock()
+
+	w := request(t, http.MethodPost, "/admin/recompute", "", "X-API-Key: secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var recomputed Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &recomputed); err != nil {
+		t.Fatal(err)
+	}
+	if recomputed.Sum != 60 || recomputed.Max != 30 || recomputed.Count != 3 {
+		t.Errorf("recomputed %+v, want the three queued transactions", recomputed)
+	}
+
+	stats := getStats(t, "/statistics")
+	if stats.Sum != 60 {
+		t.Errorf("sum %v, want 60", stats.Sum)
+	}
+	if stats.Median == nil {
+		t.Error("no median")
+	} else if *stats.Median != 20 {
+		t.Errorf("median %v, want 20", *stats.Median)
+	}
+	if cities := getStats(t, "/statistics?city=*"); cities.Count != 3 || cities.Sum != 60 {
+		t.Errorf("cities: %+v, want the three queued transactions", cities)
+	}
+}
+
+func TestRecomputeRefused(t *testing.T) {
+	setup(t, "API_KEY=secret", "SAMPLE_SIZE=2")
+	if w := request(t, http.MethodPost, "/admin/recompute", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	for _, amount := range []string{"10", "20", "30"} {
+		post(t, tx(amount, testStart), http.StatusCreated)
+	}
+	if w := request(t, http.MethodPost, "/admin/recompute", "", "X-API-Key: secret"); w.Code != http.StatusConflict {
+		t.Errorf("sampled: status %d, want %d", w.Code, http.StatusConflict)
+	}
+}
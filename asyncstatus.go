@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Outcomes reported by /transactions/status/{id}.
+const (
+	asyncQueued    = "queued"
+	asyncProcessed = "processed"
+	asyncDropped   = "dropped"
+)
+
+// AsyncStatus is what became of a transaction handed to the worker pool.
+type AsyncStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AsyncStatuses remembers the outcome of the last config.AsyncStatusSize
+// transactions queued for the workers, forgetting the oldest first.
+type AsyncStatuses struct {
+	lock     sync.Mutex
+	statuses map[string]AsyncStatus
+	order    []string
+	next     int
+}
+
+var asyncStatuses AsyncStatuses
+
+// track starts tracking a newly queued transaction and returns its ID, or
+// "" when tracking is disabled.
+func (a *AsyncStatuses) track() string {
+	if config.AsyncStatusSize <= 0 {
+		return ""
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.statuses == nil {
+		a.statuses = make(map[string]AsyncStatus)
+		a.order = make([]string, config.AsyncStatusSize)
+	}
+	delete(a.statuses, a.order[a.next])
+	a.order[a.next] = id
+	a.next = (a.next + 1) % len(a.order)
+	a.statuses[id] = AsyncStatus{ID: id, Status: asyncQueued}
+	return id
+}
+
+// finish records the outcome of the transaction with id, unless it has
+// already been forgotten.
+func (a *AsyncStatuses) finish(id, status, reason string) {
+	if id == "" {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, ok := a.statuses[id]; ok {
+		a.statuses[id] = AsyncStatus{ID: id, Status: status, Reason: reason}
+	}
+}
+
+func (a *AsyncStatuses) get(id string) (AsyncStatus, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	status, ok := a.statuses[id]
+	return status, ok
+}
+
+// asyncStatusHandler reports the outcome of a transaction answered with 202,
+// at the URL its Location header gave.
+func asyncStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, ok := asyncStatuses.get(strings.TrimPrefix(r.URL.Path, "/transactions/status/"))
+	if !ok {
+		http.Error(w, "Unknown or forgotten transaction", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncStatus(t *testing.T) {
+	setup(t, "WORKERS=1", "ASYNC_STATUS_SIZE=10", "REJECT_DUPLICATE_TIMESTAMPS=true")
+	workerPool.start(config.Workers, config.WorkerQueue)
+	defer workerPool.stop()
+
+	var locations []string
+	for _, amount := range []string{"10", "20"} {
+		w := post(t, tx(amount, testStart), http.StatusAccepted)
+		location := w.Header().Get("Location")
+		if !strings.HasPrefix(location, "/transactions/status/") {
+			t.Fatalf("Location %q", location)
+		}
+		locations = append(locations, location)
+	}
+
+	// The worker takes them in order and the second repeats the first's
+	// timestamp.
+	want := []AsyncStatus{
+		{Status: asyncProcessed},
+		{Status: asyncDropped, Reason: "A transaction with this timestamp already exists"},
+	}
+	for i, location := range locations {
+		var status AsyncStatus
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			w := request(t, http.MethodGet, location, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d: %s", location, w.Code, w.Body)
+			}
+			status = AsyncStatus{}
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Status != asyncQueued || time.Now().After(deadline) {
+				break
+			}
+		}
+		want[i].ID = strings.TrimPrefix(location, "/transactions/status/")
+		if status != want[i] {
+			t.Errorf("GET %s: %+v, want %+v", location, status, want[i])
+		}
+	}
+
+	if stats := getStats(t, "/statistics"); stats.Count != 1 || stats.Sum != 10 {
+		t.Errorf("count %d and sum %v, want the first transaction only", stats.Count, stats.Sum)
+	}
+	if w := request(t, http.MethodGet, "/transactions/status/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown ID: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	RemoteIP string    `json:"remoteIp"`
+	Method   string    `json:"method"`
+	Endpoint string    `json:"endpoint"`
+	Status   int       `json:"status"`
+	Summary  string    `json:"summary,omitempty"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// AuditLog keeps the most recent mutating requests in a ring buffer of
+// config.AuditSize entries.
+type AuditLog struct {
+	lock    sync.Mutex
+	entries []AuditEntry
+	next    int
+	full    bool
+}
+
+var auditLog AuditLog
+
+func (a *AuditLog) record(entry AuditEntry) {
+	if config.AuditSize <= 0 {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.entries == nil {
+		a.entries = make([]AuditEntry, config.AuditSize)
+	}
+	a.entries[a.next] = entry
+	a.next = (a.next + 1) % len(a.entries)
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// snapshot returns the recorded entries, oldest first.
+func (a *AuditLog) snapshot() []AuditEntry {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	entries := make([]AuditEntry, 0, len(a.entries))
+	if a.full {
+		entries = append(entries, a.entries[a.next:]...)
+	}
+	return append(entries, a.entries[:a.next]...)
+}
+
+type auditKey struct{}
+
+// auditMiddleware records every request that may change state, that is
+// anything other than GET, HEAD and OPTIONS.
+func auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entry := &AuditEntry{
+			Time:     clock(),
+			RemoteIP: clientIP(r),
+			Method:   r.Method,
+			Endpoint: r.URL.Path,
+
+			CorrelationID: correlationID(r),
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+
+		entry.Status = rec.status
+		auditLog.record(*entry)
+	})
+}
+
+// auditNote sets the summary recorded for the current request, if it is
+// being audited.
+func auditNote(r *http.Request, format string, args ...interface{}) {
+	if entry, ok := r.Context().Value(auditKey{}).(*AuditEntry); ok {
+		entry.Summary = fmt.Sprintf(format, args...)
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the address of the client. Every IP-dependent feature
+// goes through it: rate limiting, the IP filter, source tagging and the
+// audit log.
+//
+// With config.TrustForwardedFor set the first X-Forwarded-For entry is
+// taken as is. Otherwise the forwarding headers are only believed when the
+// peer is one of config.TrustedProxies: X-Forwarded-For is read from the
+// right, skipping trusted proxies, so that a client cannot spoof the
+// entries a proxy appends, and X-Real-IP is used when it is absent.
+// Requests from any other peer are attributed to the connection.
+func clientIP(r *http.Request) string {
+	if config.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	peer := remoteIP(r)
+	if !trustedProxy(peer) {
+		return peer
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			if !trustedProxy(hop) {
+				return hop
+			}
+			peer = hop
+		}
+		return peer
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); real != "" {
+		return real
+	}
+	return peer
+}
+
+// trustedProxy reports whether ip is one of config.TrustedProxies.
+func trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && containsAddr(config.TrustedProxies, addr.Unmap())
+}
+
+// requestSource attributes a transaction to the X-Source header, falling
+// back to the client IP.
+func requestSource(r *http.Request) string {
+	if source := r.Header.Get("X-Source"); source != "" {
+		return source
+	}
+	return clientIP(r)
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(auditLog.snapshot())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.5"},
+		{"untrusted real ip", "203.0.113.5:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, "203.0.113.5"},
+		{"trusted peer", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+		{"spoofed hop", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.0.0.2"}, "1.2.3.4"},
+		{"all hops trusted", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"trusted real ip", "10.0.0.1:1234", map[string]string{"X-Real-IP": " 1.2.3.4 "}, "1.2.3.4"},
+		{"trusted without headers", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"ipv6 peer", "[2001:db8::1]:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, "TRUSTED_PROXIES=10.0.0.0/8")
+			r := httptest.NewRequest(http.MethodGet, "/statistics", nil)
+			r.RemoteAddr = tt.peer
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// getAudit reads /admin/audit with the API key "secret".
+func getAudit(t *testing.T) []AuditEntry {
+	t.Helper()
+	w := request(t, http.MethodGet, "/admin/audit", "", "X-API-Key: secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/audit: status %d: %s", w.Code, w.Body)
+	}
+	var entries []AuditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	setup(t, "API_KEY=secret")
+	setCity(t, "bangalore")
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("10", testStart.Add(1)), http.StatusUnprocessableEntity)
+	getStats(t, "/statistics")
+	reset(t)
+
+	want := []AuditEntry{
+		{Method: http.MethodPost, Endpoint: "/location", Status: http.StatusNoContent, Summary: `city "bangalore"`},
+		{Method: http.MethodPost, Endpoint: "/transactions", Status: http.StatusCreated, Summary: "amount 10 at 2026-03-02T10:00:00Z"},
+		{Method: http.MethodPost, Endpoint: "/transactions", Status: http.StatusUnprocessableEntity, Summary: "amount 10 at 2026-03-02T10:00:00Z"},
+		{Method: http.MethodDelete, Endpoint: "/reset", Status: http.StatusNoContent},
+	}
+	entries := getAudit(t)
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, entry := range entries {
+		want[i].Time, want[i].RemoteIP, want[i].CorrelationID = testStart, "192.0.2.1", entry.CorrelationID
+		if !entry.Time.Equal(want[i].Time) || entry.CorrelationID == "" {
+			t.Errorf("entry %d at %v with correlation ID %q", i, entry.Time, entry.CorrelationID)
+		}
+		entry.Time = want[i].Time
+		if entry != want[i] {
+			t.Errorf("entry %d: %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestAuditLogBounded(t *testing.T) {
+	setup(t, "API_KEY=secret", "AUDIT_SIZE=3")
+	for i := range 5 {
+		post(t, tx(strconv.Itoa(i), testStart), http.StatusCreated)
+	}
+
+	// The three most recent, oldest first.
+	entries := getAudit(t)
+	if len(entries) != 3 {
+		t.Fatalf("%d entries, want 3", len(entries))
+	}
+	for i, entry := range entries {
+		if want := "amount " + strconv.Itoa(i+2) + " at 2026-03-02T10:00:00Z"; entry.Summary != want {
+			t.Errorf("entry %d: %q, want %q", i, entry.Summary, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+func requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.APIKey == "" {
+			http.Error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+
+		if !validAPIKey(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func validAPIKey(r *http.Request) bool {
+	if config.APIKey == "" {
+		return false
+	}
+	key := r.Header.Get("X-API-Key")
+	return subtle.ConstantTimeCompare([]byte(key), []byte(config.APIKey)) == 1
+}
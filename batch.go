@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// Outcomes of a batch item. A skipped item was valid but too old to be
+// counted, which a single POST /transactions answers with config.StaleStatus.
+const (
+	batchAccepted = "accepted"
+	batchSkipped  = "skipped"
+	batchRejected = "rejected"
+)
+
+// BatchItemResult reports what became of the transaction at Index.
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// batchHandler ingests a JSON array of transactions, or one transaction per
+// line when sent as application/x-ndjson, and reports the outcome of each
+// item. Items are checked as POST /transactions checks them, and a malformed
+// item is rejected without affecting the others. All of them are applied
+// under a single acquisition of the write lock, bypassing buffered writes
+// and workers. The response is 207 when the outcomes differ and 200 when
+// they are all the same.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if statsCache.resetting.Load() > 0 {
+		resetConflict(w)
+		return
+	}
+
+	var items []json.RawMessage
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == ndjsonContentType {
+		items, err = ndjsonItems(r.Body)
+	} else {
+		items, err = jsonArrayItems(r.Body)
+	}
+	if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, io.EOF) {
+		http.Error(w, "Request body is empty", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	auditNote(r, "%d transactions", len(items))
+
+	locationCache.lock.RLock()
+	city := locationCache.location.City
+	hash := locationGeohash(locationCache.location)
+	locationCache.lock.RUnlock()
+
+	source, correlation := requestSource(r), correlationID(r)
+
+	statsCache.lock.Lock()
+	now := clock()
+	results := make([]BatchItemResult, len(items))
+	for i, item := range items {
+		t := &Transaction{generation: statsCache.generation.Load()}
+		status, reason := batchItem(t, item, now)
+		if status == batchAccepted {
+			t.source, t.correlationID = source, correlation
+			t.city, t.geohash = city, hash
+			statsCache.accept(t, now)
+		}
+		results[i] = BatchItemResult{Index: i, Status: status, Reason: reason}
+	}
+	statsCache.lock.Unlock()
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status != results[0].Status {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(results)
+}
+
+// batchItem decodes and checks one batch item into t, returning its outcome
+// and, unless it is accepted, why. The caller must hold the write lock.
+func batchItem(t *Transaction, item json.RawMessage, now time.Time) (string, string) {
+	if err := json.Unmarshal(item, t); err != nil {
+		if errors.Is(err, errNullAmount) || errors.Is(err, errSchemaVersion) || errors.Is(err, errAmountNotFinite) {
+			return batchRejected, err.Error()
+		}
+		return batchRejected, "Invalid JSON"
+	}
+	t.normalize(now)
+
+	if err := firstProblem(t, now); err != nil {
+		return batchRejected, err.Message
+	}
+	if t.expired(now) {
+		metrics.observeStale()
+		return batchSkipped, "Transaction is older than the window and was not counted"
+	}
+	if _, problem := statsCache.admit(t, now); problem != "" {
+		return batchRejected, problem
+	}
+	return batchAccepted, ""
+}
+
+var errNotArray = errors.New("request body is not a JSON array")
+
+// jsonArrayItems splits a JSON array into the text of its elements without
+// parsing them, so that batchItem rejects a malformed one on its own. Only
+// the array's brackets and commas, and the nesting and strings that decide
+// which commas are the array's, must be well formed. An empty body is
+// io.EOF.
+func jsonArrayItems(body io.Reader) ([]json.RawMessage, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+	if len(data) < 2 || data[0] != '[' || data[len(data)-1] != ']' {
+		return nil, errNotArray
+	}
+
+	var items []json.RawMessage
+	depth, start := 0, 1
+	inString, escaped := false, false
+	for i := 1; i < len(data)-1; i++ {
+		switch c := data[i]; {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth--; depth < 0 {
+				return nil, errNotArray
+			}
+		case c == ',' && depth == 0:
+			items = append(items, json.RawMessage(bytes.TrimSpace(data[start:i])))
+			start = i + 1
+		}
+	}
+	if inString || depth != 0 {
+		return nil, errNotArray
+	}
+	// A trailing element is only missing from an empty array; "[1,]"
+	// leaves an empty one to be rejected.
+	if last := bytes.TrimSpace(data[start : len(data)-1]); len(last) > 0 || len(items) > 0 {
+		items = append(items, json.RawMessage(last))
+	}
+	return items, nil
+}
+
+// ndjsonItems splits body into its non-blank lines.
+func ndjsonItems(body io.Reader) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			items = append(items, json.RawMessage(bytes.Clone(line)))
+		}
+	}
+	return items, scanner.Err()
+}
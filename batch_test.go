@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	items := []string{
+		tx("10", testStart),
+		tx("20", testStart.Add(time.Hour)),
+		`{"amount":,"timestamp":"` + testStart.Format(time.RFC3339) + `"}`,
+		tx("30", testStart.Add(-2*time.Minute)),
+		`{"amount":40,"timestamp":"yesterday"}`,
+		tx("50", testStart, `"metadata":{"note":"a, b] and {c"}`),
+	}
+	want := []BatchItemResult{
+		{0, batchAccepted, ""},
+		{1, batchRejected, "Transaction timestamp is in the future"},
+		{2, batchRejected, "Invalid JSON"},
+		{3, batchSkipped, "Transaction is older than the window and was not counted"},
+		{4, batchRejected, "Invalid JSON"},
+		{5, batchAccepted, ""},
+	}
+
+	bodies := map[string]string{
+		"application/json": "[" + strings.Join(items, ",\n") + "]",
+		ndjsonContentType:  strings.Join(items, "\n") + "\n",
+	}
+	for contentType, body := range bodies {
+		t.Run(contentType, func(t *testing.T) {
+			setup(t)
+			w := request(t, http.MethodPost, "/transactions/batch", body, "Content-Type: "+contentType)
+			if w.Code != http.StatusMultiStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, http.StatusMultiStatus, w.Body)
+			}
+			var results []BatchItemResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(want) {
+				t.Fatalf("results %+v, want %+v", results, want)
+			}
+			for i := range want {
+				if results[i] != want[i] {
+					t.Errorf("item %d: %+v, want %+v", i, results[i], want[i])
+				}
+			}
+			if stats := getStats(t, "/statistics"); stats.Count != 2 || stats.Sum != 60 {
+				t.Errorf("count %d and sum %v, want the two accepted items", stats.Count, stats.Sum)
+			}
+		})
+	}
+}
+
+func TestBatchAllAccepted(t *testing.T) {
+	setup(t)
+	w := request(t, http.MethodPost, "/transactions/batch", "["+tx("1", testStart)+","+tx("2", testStart)+"]")
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+func TestJSONArrayItems(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+		err  error
+	}{
+		{"[]", nil, nil},
+		{" [ 1 , 2 ] ", []string{"1", "2"}, nil},
+		{`[{"a":[1,2]},"x,]}\"",[3]]`, []string{`{"a":[1,2]}`, `"x,]}\""`, "[3]"}, nil},
+		{"[1,]", []string{"1", ""}, nil},
+		{"[{]", nil, errNotArray},
+		{`["]`, nil, errNotArray},
+		{"[1]]", nil, errNotArray},
+		{`{"amount":1}`, nil, errNotArray},
+		{"  ", nil, io.EOF},
+	}
+	for _, tt := range tests {
+		items, err := jsonArrayItems(strings.NewReader(tt.body))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.body, err, tt.err)
+			continue
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, string(item))
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("%s: items %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
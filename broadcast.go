@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// StatsEvent describes a change to the statistics: a transaction accepted,
+// transactions evicted from the queue, or a reset. Stats is the running
+// statistics after the change, and is empty under config.LazyStats.
+type StatsEvent struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Stats Stats     `json:"stats"`
+}
+
+// Broadcaster fans StatsEvents out to subscribers. Sends never block: an
+// event a subscriber has no buffer room for is dropped for that subscriber
+// and counted, so a slow consumer cannot stall ingestion.
+type Broadcaster struct {
+	lock        sync.Mutex
+	subscribers map[chan StatsEvent]struct{}
+	dropped     uint64
+}
+
+var statsEvents Broadcaster
+
+// subscribe returns a channel of events buffered to size and a function
+// that unsubscribes and closes it.
+func (b *Broadcaster) subscribe(size int) (<-chan StatsEvent, func()) {
+	ch := make(chan StatsEvent, size)
+
+	b.lock.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan StatsEvent]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	b.lock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, ch)
+			b.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *Broadcaster) publish(event StatsEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.dropped++
+		}
+	}
+}
+
+// counts returns the number of subscribers and of events dropped so far.
+func (b *Broadcaster) counts() (int, uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return len(b.subscribers), b.dropped
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBroadcaster(t *testing.T) {
+	setup(t)
+	fast, unsubscribeFast := statsEvents.subscribe(10)
+	defer unsubscribeFast()
+	slow, unsubscribeSlow := statsEvents.subscribe(1)
+	defer unsubscribeSlow()
+
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("20", testStart), http.StatusCreated)
+	reset(t)
+
+	var types []string
+	for range 3 {
+		types = append(types, (<-fast).Type)
+	}
+	if want := []string{"accept", "accept", "reset"}; len(types) != 3 || types[0] != want[0] || types[1] != want[1] || types[2] != want[2] {
+		t.Errorf("events %v, want %v", types, want)
+	}
+
+	// The slow subscriber kept the first event and missed the others
+	// without holding up the writes.
+	if event := <-slow; event.Type != "accept" || event.Stats.Sum != 10 {
+		t.Errorf("slow subscriber got %+v, want the first accept", event)
+	}
+	if subscribers, dropped := statsEvents.counts(); subscribers != 2 || dropped != 2 {
+		t.Errorf("%d subscribers and %d dropped, want 2 and 2", subscribers, dropped)
+	}
+
+	unsubscribeSlow()
+	if _, ok := <-slow; ok {
+		t.Error("channel still open after unsubscribing")
+	}
+	unsubscribeSlow()
+	post(t, tx("30", testStart), http.StatusCreated)
+	if event := <-fast; event.Type != "accept" || event.Stats.Sum != 30 {
+		t.Errorf("after the reset got %+v, want an accept with sum 30", event)
+	}
+}
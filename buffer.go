@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// WriteBuffer holds accepted transactions that have not yet been merged
+// into statsCache, so that writers only contend on a cheap append.
+type WriteBuffer struct {
+	lock sync.Mutex
+	txs  []*Transaction
+}
+
+var writeBuffer WriteBuffer
+
+func (b *WriteBuffer) add(t *Transaction) {
+	b.lock.Lock()
+	b.txs = append(b.txs, t)
+	b.lock.Unlock()
+}
+
+func (b *WriteBuffer) take() []*Transaction {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	txs := b.txs
+	b.txs = nil
+	return txs
+}
+
+// flushWrites merges the buffered transactions into statsCache under a
+// single acquisition of the write lock. Transactions buffered before a reset
+// are dropped, as they would have been had they been written through.
+func flushWrites() {
+	txs := writeBuffer.take()
+	if len(txs) == 0 {
+		return
+	}
+
+	statsCache.lock.Lock()
+	defer statsCache.lock.Unlock()
+
+	now := clock()
+	generation := statsCache.generation.Load()
+	for _, t := range txs {
+		if t.generation == generation && !t.expired(now) {
+			statsCache.accept(t, now)
+		}
+	}
+}
+
+func flushPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		flushWrites()
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBufferedWrites(t *testing.T) {
+	// The interval is never reached, so only reads flush.
+	setup(t, "FLUSH_INTERVAL=1h")
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("30", testStart), http.StatusCreated)
+	if len(writeBuffer.txs) != 2 || len(statsCache.queue) != 0 {
+		t.Fatalf("%d buffered and %d merged, want both buffered", len(writeBuffer.txs), len(statsCache.queue))
+	}
+
+	if stats := getStats(t, "/statistics"); stats.Count != 2 || stats.Sum != 40 {
+		t.Errorf("count %d and sum %v, want the two buffered transactions", stats.Count, stats.Sum)
+	}
+	if len(writeBuffer.txs) != 0 {
+		t.Errorf("%d still buffered after a read", len(writeBuffer.txs))
+	}
+
+	// A transaction that expires in the buffer is not merged.
+	tc := setup(t, "FLUSH_INTERVAL=1h")
+	post(t, tx("50", tc.time()), http.StatusCreated)
+	tc.advance(time.Minute + time.Nanosecond)
+	post(t, tx("70", tc.time()), http.StatusCreated)
+	if stats := getStats(t, "/statistics"); stats.Count != 1 || stats.Sum != 70 {
+		t.Errorf("%+v, want only the transaction buffered last", stats)
+	}
+}
+
+func TestBufferedWritesDroppedByReset(t *testing.T) {
+	setup(t, "FLUSH_INTERVAL=1h")
+	post(t, tx("10", testStart), http.StatusCreated)
+	reset(t)
+	post(t, tx("30", testStart), http.StatusCreated)
+	if stats := getStats(t, "/statistics"); stats.Count != 1 || stats.Sum != 30 {
+		t.Errorf("count %d and sum %v, want only the transaction after the reset", stats.Count, stats.Sum)
+	}
+}
+
+func TestBufferedWritesRefuseChecks(t *testing.T) {
+	for _, env := range [][]string{
+		{"REJECT_DUPLICATE_TIMESTAMPS=true"},
+		{"MAX_BUCKETS=10"},
+		{"MAX_BUCKETS=10", "BUCKET_OVERFLOW=reject"},
+	} {
+		t.Run(strings.Join(env, ","), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("FLUSH_INTERVAL with %v was accepted", env)
+				}
+			}()
+			setup(t, append(env, "FLUSH_INTERVAL=1s")...)
+		})
+	}
+
+	// Evicting buckets needs no answer before the merge.
+	setup(t, "FLUSH_INTERVAL=1s", "MAX_BUCKETS=10", "BUCKET_OVERFLOW=evict")
+}
+
+func BenchmarkBufferedWrite(b *testing.B) {
+	for _, interval := range []string{"0s", "1h"} {
+		b.Run("flush="+interval, func(b *testing.B) {
+			tc := setup(b, "FLUSH_INTERVAL="+interval, "WINDOW=1s")
+			handler := newHandler()
+			b.ResetTimer()
+			for i := range b.N {
+				tc.advance(time.Millisecond)
+				r := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(tx("10", tc.time())))
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusCreated {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+				// Stands in for the ticker, flushing every 100ms of
+				// transactions.
+				if i%100 == 99 {
+					flushWrites()
+				}
+			}
+			flushWrites()
+		})
+	}
+}
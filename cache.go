@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bufferedResponse holds a handler's status and body so that headers
+// derived from the body can be set before anything is sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// cacheStats lets clients and proxies cache a statistics response for
+// config.StatsMaxAge and revalidate it with If-None-Match. Handlers mark
+// responses that must not be reused, such as empty statistics that would
+// hide the next transaction, by setting Cache-Control themselves.
+func cacheStats(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.StatsMaxAge <= 0 || r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		rec := &bufferedResponse{header: w.Header()}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		h := w.Header()
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		// The body is hashed before compression, so the tag is weak.
+		sum := sha256.Sum256(rec.body.Bytes())
+		etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		h.Set("ETag", etag)
+		h.Add("Vary", "Accept")
+		if h.Get("Cache-Control") == "" {
+			scope := "public"
+			if config.CookieSecret != "" {
+				// Sessions can see different statistics for the same URL.
+				scope = "private"
+			}
+			h.Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(config.StatsMaxAge.Seconds())))
+		}
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(rec.body.Bytes())
+	}
+}
+
+// etagMatches applies the weak comparison of If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
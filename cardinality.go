@@ -0,0 +1,46 @@
+package main
+
+// Cardinality counts the distinct tag values among the transactions behind
+// a /statistics response, which ?include=cardinality adds. The counts are
+// exact, from a set per tag over the queued transactions, so they cost
+// memory in proportion to the distinct values; should that become too
+// much, a HyperLogLog sketch per tag would bound it at a small relative
+// error. While the queue is sampled the counts cover the sample only.
+type Cardinality struct {
+	Cities     int `json:"cities"`
+	Categories int `json:"categories"`
+	Types      int `json:"types"`
+	Currencies int `json:"currencies"`
+	Sources    int `json:"sources"`
+}
+
+// withCardinality sets the distinct tag counts of txs on stats, unless
+// there is nothing to report or the numbers are being withheld.
+func withCardinality(stats Stats, txs []*Transaction) Stats {
+	if stats.Count == 0 || stats.InsufficientData {
+		return stats
+	}
+
+	sets := make(map[string]map[string]struct{})
+	for _, t := range txs {
+		for _, field := range []string{"city", "category", "type", "currency", "source"} {
+			value, _ := t.field(field)
+			if value == "" {
+				continue
+			}
+			if sets[field] == nil {
+				sets[field] = make(map[string]struct{})
+			}
+			sets[field][value] = struct{}{}
+		}
+	}
+
+	stats.Cardinality = &Cardinality{
+		Cities:     len(sets["city"]),
+		Categories: len(sets["category"]),
+		Types:      len(sets["type"]),
+		Currencies: len(sets["currency"]),
+		Sources:    len(sets["source"]),
+	}
+	return stats
+}
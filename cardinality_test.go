@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCardinality(t *testing.T) {
+	setup(t)
+	send := func(source string, extra ...string) {
+		t.Helper()
+		if w := request(t, http.MethodPost, "/transactions", tx("10", testStart, extra...), "X-Source: "+source); w.Code != http.StatusCreated {
+			t.Fatalf("POST /transactions: status %d: %s", w.Code, w.Body)
+		}
+	}
+	setCity(t, "mysore")
+	send("a", `"category":"food"`, `"type":"debit"`, `"currency":"INR"`)
+	send("a", `"category":"fuel"`, `"type":"debit"`, `"currency":"INR"`)
+	setCity(t, "bangalore")
+	send("b", `"category":"food"`, `"type":"credit"`, `"currency":"USD"`)
+	setCity(t, "")
+	send("a", `"category":"travel"`)
+
+	tests := []struct {
+		target string
+		want   Cardinality
+	}{
+		{"/statistics?include=cardinality", Cardinality{Cities: 2, Categories: 3, Types: 2, Currencies: 2, Sources: 2}},
+		{"/statistics?include=cardinality&city=*", Cardinality{Cities: 2, Categories: 2, Types: 2, Currencies: 2, Sources: 2}},
+		{"/statistics?include=cardinality&source=a", Cardinality{Cities: 1, Categories: 3, Types: 1, Currencies: 1, Sources: 1}},
+	}
+	for _, tt := range tests {
+		stats := getStats(t, tt.target)
+		if stats.Cardinality == nil {
+			t.Errorf("%s: no cardinality", tt.target)
+		} else if *stats.Cardinality != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.target, *stats.Cardinality, tt.want)
+		}
+	}
+
+	if stats := getStats(t, "/statistics"); stats.Cardinality != nil {
+		t.Errorf("cardinality %+v without include", *stats.Cardinality)
+	}
+}
+
+func TestCardinalityWithheld(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		post bool
+	}{
+		{"empty window", []string{"ZERO_EMPTY_STATS=true"}, false},
+		{"insufficient data", []string{"MIN_TRANSACTIONS=2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			if tt.post {
+				post(t, tx("10", testStart, `"category":"food"`), http.StatusCreated)
+			}
+			if stats := getStats(t, "/statistics?include=cardinality"); stats.Cardinality != nil {
+				t.Errorf("cardinality %+v, want none", *stats.Cardinality)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CentsStats is the JSON form of Stats under ?units=cents: every amount is
+// an integer number of cents, the smallest unit of a two-decimal currency.
+// Its fields shadow the float fields of the embedded Stats.
+type CentsStats struct {
+	Stats
+	Sum   int64 `json:"sum"`
+	Avg   int64 `json:"avg"`
+	Max   int64 `json:"max"`
+	Min   int64 `json:"min"`
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+
+	DecayedMax *int64 `json:"decayedMax,omitempty"`
+	DecayedMin *int64 `json:"decayedMin,omitempty"`
+	Median     *int64 `json:"median,omitempty"`
+	P95        *int64 `json:"p95,omitempty"`
+}
+
+// inCents reports whether the request asked for ?units=cents.
+func inCents(r *http.Request) bool {
+	return r.URL.Query().Get("units") == "cents"
+}
+
+// centsStats converts s to cents. Each amount is rounded from its shortest
+// decimal form to a whole cent with config.RoundingMode, so 10.005 becomes
+// 1000 under "half-even" and 1001 under "half-up". Avg is rounded the same
+// way from Sum/Count, and so may differ by a cent from Sum divided by Count
+// in cents.
+func centsStats(s Stats) CentsStats {
+	return CentsStats{
+		Stats: s,
+		Sum:   toCents(s.Sum),
+		Avg:   toCents(s.Avg),
+		Max:   toCents(s.Max),
+		Min:   toCents(s.Min),
+		First: toCents(s.First),
+		Last:  toCents(s.Last),
+
+		DecayedMax: optionalCents(s.DecayedMax),
+		DecayedMin: optionalCents(s.DecayedMin),
+		Median:     optionalCents(s.Median),
+		P95:        optionalCents(s.P95),
+	}
+}
+
+func toCents(v float64) int64 {
+	rounded, _ := roundDecimal(strconv.FormatFloat(v, 'f', -1, 64), 2, config.RoundingMode)
+	cents, _ := strconv.ParseInt(strings.Replace(rounded, ".", "", 1), 10, 64)
+	return cents
+}
+
+func optionalCents(v *float64) *int64 {
+	if v == nil {
+		return nil
+	}
+	cents := toCents(*v)
+	return &cents
+}
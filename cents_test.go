@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func getCentsStats(t *testing.T) CentsStats {
+	t.Helper()
+	w := request(t, http.MethodGet, "/statistics?units=cents", "")
+	var stats CentsStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	return stats
+}
+
+func TestCents(t *testing.T) {
+	tests := []struct {
+		amount string
+		mode   string
+		cents  int64
+	}{
+		{"10.25", roundHalfEven, 1025},
+		{"0.1", roundHalfEven, 10},
+		{"-3.333", roundHalfEven, -333},
+		// 19.995 is a tie in decimal, though 19.995*100 is just below
+		// 1999.5 in float64.
+		{"19.995", roundHalfEven, 2000},
+		{"10.005", roundHalfEven, 1000},
+		{"10.005", roundHalfUp, 1001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.amount, func(t *testing.T) {
+			setup(t, "ROUNDING_MODE="+tt.mode)
+			post(t, tx(tt.amount, testStart), http.StatusCreated)
+			stats := getCentsStats(t)
+			for name, got := range map[string]int64{"sum": stats.Sum, "avg": stats.Avg, "max": stats.Max, "min": stats.Min, "first": stats.First, "last": stats.Last} {
+				if got != tt.cents {
+					t.Errorf("%s %d, want %d", name, got, tt.cents)
+				}
+			}
+		})
+	}
+}
+
+func TestCentsMatchFloats(t *testing.T) {
+	setup(t, "MEDIAN=true")
+	for _, amount := range []string{"10.25", "0.1", "0.2", "-3.333", "99.99", "7"} {
+		post(t, tx(amount, testStart), http.StatusCreated)
+	}
+
+	floats := getStats(t, "/statistics")
+	cents := getCentsStats(t)
+	for _, field := range []struct {
+		name  string
+		float float64
+		cents int64
+	}{
+		{"sum", floats.Sum, cents.Sum},
+		{"avg", floats.Avg, cents.Avg},
+		{"max", floats.Max, cents.Max},
+		{"min", floats.Min, cents.Min},
+		{"median", *floats.Median, *cents.Median},
+	} {
+		if math.Abs(field.float*100-float64(field.cents)) > 0.5 {
+			t.Errorf("%s: %d cents for %v", field.name, field.cents, field.float)
+		}
+	}
+	if cents.Count != floats.Count {
+		t.Errorf("count %d, want %d", cents.Count, floats.Count)
+	}
+}
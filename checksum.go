@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// wantsChecksum reports whether the request asked for ?checksum=true.
+func wantsChecksum(r *http.Request) bool {
+	ok, _ := strconv.ParseBool(r.URL.Query().Get("checksum"))
+	return ok
+}
+
+// writeChecksummed writes v as JSON with a trailing "checksum" member: the
+// hex SHA-256 of the body without it. Members are always encoded in
+// the same order, so to verify a response a client removes the final
+//
+//	,"checksum":"<hex>"
+//
+// and hashes the bytes that are left, from the opening brace to the closing
+// one, without the trailing newline.
+func writeChecksummed(w http.ResponseWriter, v any) {
+	body, _ := json.Marshal(v)
+	sum := sha256.Sum256(body)
+
+	body = append(body[:len(body)-1], `,"checksum":"`...)
+	body = hex.AppendEncode(body, sum[:])
+	body = append(body, "\"}\n"...)
+	w.Write(body)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	setup(t, "MEDIAN=true")
+	post(t, tx("10.5", testStart), http.StatusCreated)
+	post(t, tx("-3", testStart), http.StatusCreated)
+
+	for _, target := range []string{"/statistics?checksum=true", "/statistics?checksum=true&units=cents", "/statistics?checksum=true&fields=sum,count"} {
+		w := request(t, http.MethodGet, target, "")
+		body := strings.TrimSuffix(w.Body.String(), "\n")
+
+		// Recompute it as a client would.
+		i := strings.LastIndex(body, `,"checksum":"`)
+		if i < 0 {
+			t.Fatalf("%s: no checksum in %s", target, body)
+		}
+		checksum := strings.TrimSuffix(body[i+len(`,"checksum":"`):], `"}`)
+		sum := sha256.Sum256([]byte(body[:i] + "}"))
+		if checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: checksum %s, recomputed %x", target, checksum, sum)
+		}
+
+		var members map[string]any
+		if err := json.Unmarshal([]byte(body), &members); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+
+		if again := request(t, http.MethodGet, target, ""); again.Body.String() != w.Body.String() {
+			t.Errorf("%s: bodies differ between requests:\n%s\n%s", target, w.Body, again.Body)
+		}
+	}
+}
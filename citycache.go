@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// allCitiesKey caches the merge of every city bucket.
+const allCitiesKey = "*"
+
+// CityStatsCache keeps per-city statistics for config.CityCacheTTL so that
+// repeated reads do not recompute them. Entries are computed under the
+// statistics read lock and invalidated under the write lock whenever a
+// write or eviction could change them, so a read always reflects the
+// writes before it.
+type CityStatsCache struct {
+	lock    sync.Mutex
+	entries map[string]cachedCityStats
+	hits    uint64
+	misses  uint64
+}
+
+type cachedCityStats struct {
+	bucket   StatsBucket
+	found    bool
+	cachedAt time.Time
+}
+
+// get returns the cached bucket for city, or computes and caches it.
+func (c *CityStatsCache) get(city string, now time.Time, compute func() (StatsBucket, bool)) (StatsBucket, bool) {
+	if config.CityCacheTTL <= 0 {
+		return compute()
+	}
+
+	c.lock.Lock()
+	entry, ok := c.entries[city]
+	if ok && now.Sub(entry.cachedAt) < config.CityCacheTTL {
+		c.hits++
+		c.lock.Unlock()
+		return entry.bucket, entry.found
+	}
+	c.misses++
+	c.lock.Unlock()
+
+	bucket, found := compute()
+
+	c.lock.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedCityStats)
+	}
+	c.entries[city] = cachedCityStats{bucket: bucket, found: found, cachedAt: now}
+	c.lock.Unlock()
+	return bucket, found
+}
+
+// invalidate drops the entries a write for city changes.
+func (c *CityStatsCache) invalidate(city string) {
+	c.lock.Lock()
+	delete(c.entries, city)
+	delete(c.entries, allCitiesKey)
+	c.lock.Unlock()
+}
+
+func (c *CityStatsCache) clear() {
+	c.lock.Lock()
+	c.entries = nil
+	c.lock.Unlock()
+}
+
+// counts returns the number of reads served from and missing the cache.
+func (c *CityStatsCache) counts() (uint64, uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.hits, c.misses
+}
+
+// cityStats returns the bucket for city, or for allCitiesKey the merge of
+// every live city, through the cache. The caller must hold the read lock.
+func (c *StatsCache) cityStats(city string, now time.Time) (StatsBucket, bool) {
+	return c.cityCache.get(city, now, func() (StatsBucket, bool) {
+		if city == allCitiesKey {
+			return StatsBucket{stats: allCities(now), lastUpdated: now}, true
+		}
+		cities, _, _ := c.buckets(now)
+		bucket, ok := cities[city]
+		if !ok {
+			return StatsBucket{}, false
+		}
+		return *bucket, true
+	})
+}
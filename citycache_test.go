@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCityCache(t *testing.T) {
+	tc := setup(t, "CITY_CACHE_TTL=5s", "API_KEY=secret")
+	read := func(city string) Stats {
+		t.Helper()
+		w := request(t, http.MethodGet, "/admin/statistics?city="+city, "", "X-API-Key: secret")
+		var stats Stats
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+		return stats
+	}
+
+	setCity(t, "bangalore")
+	post(t, tx("10", testStart), http.StatusCreated)
+	read("bangalore")
+	read("*")
+	if stats := read("bangalore"); stats.Count != 1 {
+		t.Errorf("cached: count %d, want 1", stats.Count)
+	}
+	if hits, misses := statsCache.cityCache.counts(); hits != 1 || misses != 2 {
+		t.Errorf("%d hits and %d misses, want 1 and 2", hits, misses)
+	}
+
+	// A write shows in the next read even within the TTL.
+	post(t, tx("20", testStart), http.StatusCreated)
+	if stats := read("bangalore"); stats.Count != 2 || stats.Sum != 30 {
+		t.Errorf("after a write: %+v, want 2 transactions summing to 30", stats)
+	}
+	if stats := read("*"); stats.Count != 2 {
+		t.Errorf("after a write: all cities count %d, want 2", stats.Count)
+	}
+
+	// So does an eviction.
+	tc.advance(58 * time.Second)
+	setCity(t, "mysore")
+	post(t, tx("5", tc.time()), http.StatusCreated)
+	if stats := read("*"); stats.Count != 3 {
+		t.Errorf("before the eviction: all cities count %d, want 3", stats.Count)
+	}
+	// The write has no city, so only the eviction it causes invalidates.
+	tc.advance(3 * time.Second)
+	setCity(t, "")
+	post(t, tx("5", tc.time()), http.StatusCreated)
+	if stats := read("*"); stats.Count != 1 || stats.Sum != 5 {
+		t.Errorf("after the eviction: all cities %+v, want mysore's transaction", stats)
+	}
+}
+
+func BenchmarkCityStats(b *testing.B) {
+	for _, ttl := range []string{"0s", "1s"} {
+		b.Run("ttl "+ttl, func(b *testing.B) {
+			setup(b, "CITY_CACHE_TTL="+ttl, "WINDOW=1h")
+			statsCache.lock.Lock()
+			for i := range 10000 {
+				t := &Transaction{Amount: float64(i), Timestamp: testStart, city: "city" + strconv.Itoa(i%100)}
+				statsCache.accept(t, testStart)
+			}
+			statsCache.lock.Unlock()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					statsCache.lock.RLock()
+					statsCache.cityStats(allCitiesKey, testStart)
+					statsCache.lock.RUnlock()
+				}
+			})
+		})
+	}
+}
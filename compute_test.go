@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	setup(t)
+	amounts := []string{"10", "25.5", "4", "100"}
+	body := "["
+	for i, amount := range amounts {
+		if i > 0 {
+			body += ","
+		}
+		body += tx(amount, testStart)
+	}
+	body += "]"
+
+	// The same transactions posted live, then the cache put back to empty.
+	for _, amount := range amounts {
+		post(t, tx(amount, testStart), http.StatusCreated)
+	}
+	live := getStats(t, "/statistics")
+	setup(t)
+
+	w := request(t, http.MethodPost, "/statistics/compute", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var computed Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &computed); err != nil {
+		t.Fatal(err)
+	}
+	if computed.Sum != live.Sum || computed.Avg != live.Avg || computed.Max != live.Max ||
+		computed.Min != live.Min || computed.Count != live.Count || computed.First != live.First || computed.Last != live.Last {
+		t.Errorf("computed %+v, want the live %+v", computed, live)
+	}
+
+	// Old transactions are aggregated all the same, and none reach the
+	// cache or the metrics.
+	w = request(t, http.MethodPost, "/statistics/compute", "["+tx("7", testStart.AddDate(-1, 0, 0))+"]")
+	if err := json.Unmarshal(w.Body.Bytes(), &computed); err != nil || computed.Count != 1 || computed.Sum != 7 {
+		t.Errorf("a year old: %s, want it counted", w.Body)
+	}
+	if len(statsCache.queue) != 0 || statsCache.stats != (Stats{}) || statsCache.processed != 0 || !statsCache.lastUpdated.IsZero() {
+		t.Errorf("cache changed: %d queued, %+v", len(statsCache.queue), statsCache.stats)
+	}
+	if stats := getStats(t, "/statistics"); stats.Count != 0 {
+		t.Errorf("count %d after computing, want 0", stats.Count)
+	}
+}
+
+func TestComputeInvalid(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"empty array", "[]", http.StatusOK},
+		{"not an array", tx("10", testStart), http.StatusBadRequest},
+		{"malformed", "[" + tx("10", testStart), http.StatusBadRequest},
+		{"bad amount", `[{"amount":"ten","timestamp":"` + testStart.Format("2006-01-02T15:04:05Z") + `"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			w := request(t, http.MethodPost, "/statistics/compute", tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	setup(t)
+	if w := request(t, http.MethodPost, "/statistics/compute", "[]"); w.Body.String() != "{}" {
+		t.Errorf("empty array: %q, want empty statistics", w.Body)
+	}
+}
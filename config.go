@@ -0,0 +1,696 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Addr is the TCP address to listen on and UnixSocket an optional
+	// socket path to serve on as well. Either may be empty, but not both.
+	Addr       string
+	UnixSocket string
+
+	// TLSCertFile and TLSKeyFile, when both set, serve HTTPS on Addr. The
+	// Unix socket stays plain. TLSMinVersion is "1.2" (the default) or
+	// "1.3". TLSCipherSuites restricts the TLS 1.2 cipher suites to the
+	// named ones; by default Go's secure suites are offered. Older
+	// versions and insecure suites are refused at startup.
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   uint16
+	TLSCipherSuites []uint16
+
+	// H2C serves HTTP/2 without TLS to clients that use it with prior
+	// knowledge, alongside HTTP/1.1; it is off by default. HTTP2MaxStreams
+	// caps the concurrent streams per HTTP/2 connection, 250 by default.
+	H2C             bool
+	HTTP2MaxStreams int
+
+	// KeepAlives keeps idle HTTP/1.1 connections open for reuse, for up
+	// to IdleTimeout (2m by default) between requests. HTTP/2 connections
+	// are closed after the same idle time.
+	KeepAlives  bool
+	IdleTimeout time.Duration
+
+	APIKey string
+
+	// AmountField and TimestampField are the JSON keys transactions carry
+	// their amount and timestamp under.
+	AmountField    string
+	TimestampField string
+
+	// RejectNullAmount answers 400 to "amount": null. Otherwise it counts
+	// as zero, as does a missing amount.
+	RejectNullAmount bool
+
+	// DefaultTimestampNow counts transactions with a missing or zero
+	// timestamp at the time they are received.
+	DefaultTimestampNow bool
+
+	// Window is the initial statistics window.
+	Window time.Duration
+
+	// WindowMode is "sliding" (the default), where a transaction counts
+	// until it is a window old, or "tumbling", where the statistics cover
+	// the current multiple of the window since midnight UTC and start
+	// afresh at each boundary; see expired.
+	WindowMode string
+
+	// Retention is how long transactions stay queued for the queue-derived
+	// endpoints, such as /statistics/timeseries?span=, to look further
+	// back than the window. It is never less than the window. Every
+	// accepted transaction is held for this long, so memory use grows with
+	// the ingest rate times Retention.
+	Retention time.Duration
+
+	// MaxAmountScale is the most decimal places a transaction amount may
+	// carry. A negative value disables the check.
+	MaxAmountScale int
+
+	// SignRules maps a transaction type to the sign its amount must have,
+	// "positive" or "negative", such as credit=positive,debit=negative.
+	// Types without a rule may have either sign.
+	SignRules map[string]string
+
+	// RoundAmounts rounds incoming amounts to this many decimal places,
+	// ties going the way RoundingMode says, before they are validated or
+	// counted. A negative value keeps amounts as sent.
+	RoundAmounts int
+	RoundingMode string
+
+	// ExactAmounts rejects amounts that float64 would round, such as
+	// integers beyond 2^53, instead of silently storing the nearest value.
+	ExactAmounts bool
+
+	// MinAge and MaxAge bound the age of an acceptable transaction, and
+	// those outside get a 422 saying which end they missed. A negative
+	// MinAge tolerates timestamps that far in the future. Zero MaxAge
+	// leaves old transactions to the window and StaleStatus.
+	MinAge time.Duration
+	MaxAge time.Duration
+
+	// StaleStatus is the status answered to a transaction older than the
+	// window: 204, or 202 or 422 with a body saying it was not counted.
+	StaleStatus int
+
+	// SampleSize caps how many transactions the queue holds. Once the
+	// window has more than this, the queue becomes a uniform reservoir
+	// sample. Zero keeps every transaction.
+	SampleSize int
+
+	// GzipMinSize is the smallest response body worth compressing, and
+	// GzipTypes the media types that may be compressed. An entry such as
+	// "text/*" matches a whole type.
+	GzipMinSize int
+	GzipTypes   []string
+
+	// MaxBodyBytes caps request bodies, after decompression for those
+	// sent with Content-Encoding: gzip, so that a small compressed upload
+	// cannot expand without bound. Larger bodies get 413.
+	MaxBodyBytes int64
+
+	// DecayHalfLife enables the decayedMax and decayedMin statistics, in
+	// which a transaction's distance from the average halves every
+	// DecayHalfLife. Zero disables them.
+	DecayHalfLife time.Duration
+
+	// Median maintains the median amount of the window for /statistics,
+	// which then also reports the 95th percentile for ?include=p95. It
+	// keeps a reference to every transaction in the window, sampled or not.
+	// PercentileMethod is how both are interpolated; see percentile.go.
+	Median           bool
+	PercentileMethod string
+
+	// MinTransactions is how many transactions /statistics needs before it
+	// reports numbers rather than "insufficientData": true.
+	MinTransactions int
+
+	// StatsMaxAge is how long clients and proxies may cache a /statistics
+	// response, sent as Cache-Control: max-age along with an ETag. Zero
+	// sends neither.
+	StatsMaxAge time.Duration
+
+	// StaleWarning is the fraction of the window after which /statistics
+	// sends a Warning header saying the statistics are about to go stale.
+	// Zero never warns.
+	StaleWarning float64
+
+	// ZeroEmptyStats makes the statistics endpoints report zeros instead
+	// of "{}" when the window is empty or stale.
+	ZeroEmptyStats bool
+
+	// WarmUp is how long after a reset /statistics reports
+	// "warming": true instead of numbers.
+	WarmUp time.Duration
+
+	// DriftCheckEvery runs the float drift check after every N accepted
+	// transactions, correcting Sum when it is off by more than
+	// DriftTolerance. Zero disables the check.
+	DriftCheckEvery int
+	DriftTolerance  float64
+
+	// AuditSize is how many mutating requests /admin/audit retains. Zero
+	// disables the audit log.
+	AuditSize int
+
+	// DebugBodySample is the fraction of requests, from 0 to 1, whose
+	// request and response bodies are logged, up to DebugBodyLimit bytes
+	// each. Zero disables the logging.
+	DebugBodySample float64
+	DebugBodyLimit  int
+
+	// CORSOrigins lists the origins allowed to call the API from a
+	// browser; "*" allows any. CORSCredentials sends
+	// Access-Control-Allow-Credentials and so needs explicit origins.
+	// CORSMaxAge is how long browsers may cache a preflight response.
+	CORSOrigins     []string
+	CORSCredentials bool
+	CORSMaxAge      time.Duration
+
+	// GeohashPrecision is the geohash length used to bucket transactions
+	// by the active location's coordinates.
+	GeohashPrecision int
+
+	// ResetConfirmation makes DELETE /reset require either a token from
+	// DELETE /reset?dryRun=true, valid for ResetTokenTTL, or ?force=true
+	// with the API key.
+	ResetConfirmation bool
+	ResetTokenTTL     time.Duration
+
+	// ReadTimeout and WriteTimeout bound how long GET/HEAD and other
+	// requests may take before the client gets a 503. RouteTimeouts
+	// overrides both for specific paths. Zero disables the timeout. The
+	// streaming routes never time out, and RouteTimeouts cannot name them.
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	RouteTimeouts map[string]time.Duration
+
+	// RejectDuplicateTimestamps answers 409 to a transaction whose
+	// timestamp matches one already in the window.
+	RejectDuplicateTimestamps bool
+
+	// TrustForwardedFor attributes requests to the first X-Forwarded-For
+	// address rather than the connection's. Only enable it behind a proxy
+	// that sets the header, as clients can otherwise spoof it;
+	// TrustedProxies is the safer choice.
+	TrustForwardedFor bool
+
+	// TrustedProxies are the CIDR ranges of the proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed. Requests from
+	// any other peer are attributed to the connection's address.
+	TrustedProxies []netip.Prefix
+
+	// IPAllow and IPDeny are the CIDR ranges, or single addresses, that
+	// may and may not send mutating requests. The denylist wins, and an
+	// empty allowlist allows everyone.
+	IPAllow []netip.Prefix
+	IPDeny  []netip.Prefix
+
+	// ReadRateLimit, WriteRateLimit and AdminRateLimit limit each client's
+	// GET and HEAD requests, other requests, and requests to /admin/,
+	// each group on its own. They are written as "100/1s"; zero requests
+	// disables the limit.
+	ReadRateLimit  Rate
+	WriteRateLimit Rate
+	AdminRateLimit Rate
+
+	// CookieSecret signs the per-session location cookie set by
+	// /location/session. Sessions are disabled when it is empty.
+	CookieSecret string
+
+	// StateFile is where the active location is saved whenever it
+	// changes, and restored from at startup. Empty disables persistence.
+	StateFile string
+
+	// DedupLocation makes a POST /location that matches the current
+	// location a no-op, answered with 200 and "unchanged", so that it is
+	// neither saved nor audited as a change.
+	DedupLocation bool
+
+	// NormalizeCities stores and compares city names lowercased, trimmed
+	// and with runs of whitespace collapsed, so " Bangalore" and
+	// "BANGALORE" are both authorized as "bangalore".
+	NormalizeCities bool
+
+	// FlushInterval enables buffered writes: accepted transactions are
+	// held in a buffer and merged into the statistics at this interval,
+	// or sooner when a statistics endpoint is read. It cannot be combined
+	// with RejectDuplicateTimestamps, or with MaxBuckets under the "reject"
+	// policy, whose checks must answer before the transaction is merged.
+	// Zero writes straight through.
+	FlushInterval time.Duration
+
+	// ResetEvery resets the statistics at every multiple of this interval
+	// since midnight UTC, and at midnight, so 1h resets on the hour, 7h at
+	// 07:00, 14:00, 21:00 and midnight, and 24h at midnight.
+	// ResetLogStats logs the statistics being cleared first. Zero never
+	// resets on a schedule.
+	ResetEvery    time.Duration
+	ResetLogStats bool
+
+	// WebhookURL is sent an Alert when one of WebhookRules, such as
+	// "avg>100,count>=50", starts to hold; see watchThresholds.
+	WebhookURL   string
+	WebhookRules []ThresholdRule
+
+	// CityCacheTTL keeps computed per-city statistics for this long, or
+	// until a write for the city or an eviction, so that polling a city
+	// does not recompute them. Zero disables the cache.
+	CityCacheTTL time.Duration
+
+	// LazyStats keeps no running statistics: writes only queue the
+	// transaction, and every read aggregates the queue instead. It cannot
+	// be combined with SampleSize or WebhookRules, which need the running
+	// statistics.
+	LazyStats bool
+
+	// Workers applies accepted transactions on this many goroutines,
+	// answering 202 once a transaction is validated and queued. At most
+	// WorkerQueue transactions wait; beyond that clients get 503. Zero
+	// applies transactions in the request. Buffered writes take precedence.
+	Workers     int
+	WorkerQueue int
+
+	// AsyncStatusSize makes the 202 for a transaction queued for the
+	// workers carry a Location to poll for its outcome, remembering the
+	// last AsyncStatusSize of them. Zero sends no Location.
+	AsyncStatusSize int
+
+	// MaxBuckets caps the number of distinct city, geohash and currency
+	// buckets of each kind. Once reached, BucketOverflow decides what
+	// happens to a transaction with a new key: "reject" answers 422, "evict"
+	// drops the least recently updated bucket. Zero means no cap.
+	MaxBuckets     int
+	BucketOverflow string
+
+	// CurrencyStats keeps statistics per currency, served by
+	// /statistics?currency= without any conversion, and requires
+	// transaction currencies to be ISO 4217 codes.
+	CurrencyStats bool
+}
+
+var config Config
+
+func loadConfig() Config {
+	cfg := Config{
+		TLSCertFile:     envString("TLS_CERT_FILE", ""),
+		TLSKeyFile:      envString("TLS_KEY_FILE", ""),
+		TLSMinVersion:   envTLSVersion("TLS_MIN_VERSION"),
+		TLSCipherSuites: envCipherSuites("TLS_CIPHER_SUITES"),
+
+		H2C:             envBool("H2C", false),
+		HTTP2MaxStreams: envInt("HTTP2_MAX_STREAMS", 250),
+		KeepAlives:      envBool("KEEP_ALIVES", true),
+		IdleTimeout:     envDuration("IDLE_TIMEOUT", time.Minute*2),
+
+		Addr:           envString("ADDR", ":8080"),
+		UnixSocket:     envString("UNIX_SOCKET", ""),
+		APIKey:         envString("API_KEY", ""),
+		AmountField:    envString("AMOUNT_FIELD", "amount"),
+		TimestampField: envString("TIMESTAMP_FIELD", "timestamp"),
+		Window:         envPositiveDuration("WINDOW", time.Second*60),
+		WindowMode:     envString("WINDOW_MODE", windowSliding),
+		Retention:      envDuration("RETENTION", 0),
+		MaxAmountScale: envInt("MAX_AMOUNT_SCALE", -1),
+		ExactAmounts:   envBool("EXACT_AMOUNTS", false),
+		RoundAmounts:   envInt("ROUND_AMOUNTS", -1),
+		RoundingMode:   envString("ROUNDING_MODE", roundHalfEven),
+		SignRules:      envSignRules("SIGN_RULES"),
+		StaleStatus:    envInt("STALE_STATUS", http.StatusNoContent),
+		SampleSize:     envInt("SAMPLE_SIZE", 0),
+		GzipMinSize:    envInt("GZIP_MIN_SIZE", 1024),
+		GzipTypes:      envList("GZIP_TYPES", []string{"application/json", "text/*"}),
+		ZeroEmptyStats: envBool("ZERO_EMPTY_STATS", false),
+		MaxBodyBytes:   int64(envInt("MAX_BODY_BYTES", 10<<20)),
+		WarmUp:         envDuration("WARM_UP", 0),
+
+		DefaultTimestampNow: envBool("DEFAULT_TIMESTAMP_NOW", false),
+		RejectNullAmount:    envBool("REJECT_NULL_AMOUNT", false),
+		MinTransactions:     envInt("MIN_TRANSACTIONS", 1),
+		DecayHalfLife:       envDuration("DECAY_HALF_LIFE", 0),
+		Median:              envBool("MEDIAN", false),
+		PercentileMethod:    envString("PERCENTILE_METHOD", percentileLinear),
+		MinAge:              envDuration("MIN_AGE", 0),
+		MaxAge:              envDuration("MAX_AGE", 0),
+		StatsMaxAge:         envDuration("STATS_MAX_AGE", 0),
+
+		DriftCheckEvery: envInt("DRIFT_CHECK_EVERY", 0),
+		DriftTolerance:  envFloat("DRIFT_TOLERANCE", 1e-9),
+
+		AuditSize: envInt("AUDIT_SIZE", 1000),
+
+		DebugBodySample: envFloat("DEBUG_BODY_SAMPLE", 0),
+		DebugBodyLimit:  envInt("DEBUG_BODY_LIMIT", 4096),
+
+		CORSOrigins:     envList("CORS_ORIGINS", nil),
+		CORSCredentials: envBool("CORS_CREDENTIALS", false),
+		CORSMaxAge:      envDuration("CORS_MAX_AGE", 0),
+
+		GeohashPrecision: envInt("GEOHASH_PRECISION", 6),
+
+		ResetConfirmation: envBool("RESET_CONFIRMATION", false),
+		ResetTokenTTL:     envPositiveDuration("RESET_TOKEN_TTL", time.Second*30),
+
+		ReadTimeout:   envDuration("READ_TIMEOUT", 0),
+		WriteTimeout:  envDuration("WRITE_TIMEOUT", 0),
+		RouteTimeouts: envDurationMap("ROUTE_TIMEOUTS"),
+
+		RejectDuplicateTimestamps: envBool("REJECT_DUPLICATE_TIMESTAMPS", false),
+
+		TrustForwardedFor: envBool("TRUST_FORWARDED_FOR", false),
+		TrustedProxies:    envPrefixList("TRUSTED_PROXIES"),
+		IPAllow:           envPrefixList("IP_ALLOW"),
+		IPDeny:            envPrefixList("IP_DENY"),
+
+		ReadRateLimit:  envRate("READ_RATE_LIMIT"),
+		WriteRateLimit: envRate("WRITE_RATE_LIMIT"),
+		AdminRateLimit: envRate("ADMIN_RATE_LIMIT"),
+
+		CookieSecret: envString("COOKIE_SECRET", ""),
+
+		StateFile:       envString("STATE_FILE", ""),
+		DedupLocation:   envBool("DEDUP_LOCATION", false),
+		NormalizeCities: envBool("NORMALIZE_CITIES", false),
+
+		FlushInterval: envDuration("FLUSH_INTERVAL", 0),
+		LazyStats:     envBool("LAZY_STATS", false),
+		CityCacheTTL:  envDuration("CITY_CACHE_TTL", 0),
+
+		ResetEvery:    envDuration("RESET_EVERY", 0),
+		ResetLogStats: envBool("RESET_LOG_STATS", false),
+
+		WebhookURL:   envString("WEBHOOK_URL", ""),
+		WebhookRules: envThresholdRules("WEBHOOK_RULES"),
+
+		Workers:     envInt("WORKERS", 0),
+		WorkerQueue: envInt("WORKER_QUEUE", 1024),
+
+		AsyncStatusSize: envInt("ASYNC_STATUS_SIZE", 0),
+
+		MaxBuckets:     envInt("MAX_BUCKETS", 0),
+		BucketOverflow: envString("BUCKET_OVERFLOW", "reject"),
+
+		CurrencyStats: envBool("CURRENCY_STATS", false),
+
+		StaleWarning: envFloat("STALE_WARNING", 0),
+	}
+
+	switch cfg.StaleStatus {
+	case http.StatusNoContent, http.StatusAccepted, http.StatusUnprocessableEntity:
+	default:
+		invalidEnv("STALE_STATUS", strconv.Itoa(cfg.StaleStatus), errors.New("must be 204, 202 or 422"))
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		invalidEnv("TLS_KEY_FILE", cfg.TLSKeyFile, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	for route := range cfg.RouteTimeouts {
+		if slices.Contains(streamingRoutes, route) {
+			invalidEnv("ROUTE_TIMEOUTS", route, errors.New("streaming routes cannot have a timeout"))
+		}
+	}
+
+	if cfg.HTTP2MaxStreams <= 0 {
+		invalidEnv("HTTP2_MAX_STREAMS", strconv.Itoa(cfg.HTTP2MaxStreams), errors.New("must be positive"))
+	}
+
+	if cfg.WorkerQueue < 0 {
+		invalidEnv("WORKER_QUEUE", strconv.Itoa(cfg.WorkerQueue), errors.New("must not be negative"))
+	}
+
+	if cfg.WindowMode != windowSliding && cfg.WindowMode != windowTumbling {
+		invalidEnv("WINDOW_MODE", cfg.WindowMode, errors.New(`must be "sliding" or "tumbling"`))
+	}
+
+	if cfg.RoundingMode != roundHalfEven && cfg.RoundingMode != roundHalfUp {
+		invalidEnv("ROUNDING_MODE", cfg.RoundingMode, errors.New(`must be "half-even" or "half-up"`))
+	}
+
+	if !slices.Contains(percentileMethods, cfg.PercentileMethod) {
+		invalidEnv("PERCENTILE_METHOD", cfg.PercentileMethod, errors.New("must be one of "+strings.Join(percentileMethods, ", ")))
+	}
+
+	if cfg.BucketOverflow != "reject" && cfg.BucketOverflow != "evict" {
+		invalidEnv("BUCKET_OVERFLOW", cfg.BucketOverflow, errors.New(`must be "reject" or "evict"`))
+	}
+
+	if cfg.GeohashPrecision < 1 || cfg.GeohashPrecision > maxGeohashPrecision {
+		invalidEnv("GEOHASH_PRECISION", strconv.Itoa(cfg.GeohashPrecision), fmt.Errorf("must be between 1 and %d", maxGeohashPrecision))
+	}
+
+	if cfg.StaleWarning < 0 || cfg.StaleWarning > 1 {
+		invalidEnv("STALE_WARNING", strconv.FormatFloat(cfg.StaleWarning, 'g', -1, 64), errors.New("must be between 0 and 1"))
+	}
+
+	if cfg.LazyStats && cfg.SampleSize > 0 {
+		invalidEnv("SAMPLE_SIZE", strconv.Itoa(cfg.SampleSize), errors.New("cannot be combined with LAZY_STATS"))
+	}
+	if cfg.LazyStats && len(cfg.WebhookRules) > 0 {
+		invalidEnv("WEBHOOK_RULES", os.Getenv("WEBHOOK_RULES"), errors.New("cannot be combined with LAZY_STATS"))
+	}
+
+	if cfg.FlushInterval > 0 && cfg.RejectDuplicateTimestamps {
+		invalidEnv("REJECT_DUPLICATE_TIMESTAMPS", "true", errors.New("cannot be combined with FLUSH_INTERVAL"))
+	}
+	if cfg.FlushInterval > 0 && cfg.MaxBuckets > 0 && cfg.BucketOverflow == "reject" {
+		invalidEnv("BUCKET_OVERFLOW", cfg.BucketOverflow, errors.New(`must be "evict" when MAX_BUCKETS is combined with FLUSH_INTERVAL`))
+	}
+
+	if len(cfg.WebhookRules) > 0 && cfg.WebhookURL == "" {
+		invalidEnv("WEBHOOK_URL", "", errors.New("must be set along with WEBHOOK_RULES"))
+	}
+
+	if cfg.CORSCredentials && slices.Contains(cfg.CORSOrigins, "*") {
+		invalidEnv("CORS_ORIGINS", "*", errors.New("a wildcard origin cannot be combined with CORS_CREDENTIALS"))
+	}
+
+	return cfg
+}
+
+func envString(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		invalidEnv(key, value, err)
+	}
+	return n
+}
+
+func envFloat(key string, def float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		invalidEnv(key, value, err)
+	}
+	return f
+}
+
+func envBool(key string, def bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		invalidEnv(key, value, err)
+	}
+	return b
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		invalidEnv(key, value, err)
+	}
+	return d
+}
+
+func envPositiveDuration(key string, def time.Duration) time.Duration {
+	d := envDuration(key, def)
+	if d <= 0 {
+		invalidEnv(key, d.String(), errors.New("must be positive"))
+	}
+	return d
+}
+
+// envList reads a comma-separated list, ignoring blank entries.
+func envList(key string, def []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envRate reads a rate limit written as requests/duration, such as "10/1s".
+func envRate(key string) Rate {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return Rate{}
+	}
+	requests, per, ok := strings.Cut(value, "/")
+	if !ok {
+		invalidEnv(key, value, errors.New("expected requests/duration"))
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil {
+		invalidEnv(key, value, err)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		invalidEnv(key, value, errors.New("duration must be positive"))
+	}
+	return Rate{Requests: n, Per: d}
+}
+
+// Signs for config.SignRules.
+const (
+	signPositive = "positive"
+	signNegative = "negative"
+)
+
+// envSignRules reads a comma-separated list of type=sign pairs.
+func envSignRules(key string) map[string]string {
+	rules := make(map[string]string)
+	for _, item := range envList(key, nil) {
+		name, sign, ok := strings.Cut(item, "=")
+		if !ok || sign != signPositive && sign != signNegative {
+			invalidEnv(key, item, errors.New("expected type=positive or type=negative"))
+		}
+		rules[strings.TrimSpace(name)] = sign
+	}
+	return rules
+}
+
+// envThresholdRules reads a comma-separated list of threshold rules such as
+// "avg>100".
+func envThresholdRules(key string) []ThresholdRule {
+	var rules []ThresholdRule
+	for _, item := range envList(key, nil) {
+		rule, ok := parseThresholdRule(item)
+		if !ok {
+			invalidEnv(key, item, errors.New("expected stat, operator and number, such as avg>100"))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func parseThresholdRule(s string) (ThresholdRule, bool) {
+	for _, stat := range thresholdStats {
+		rest, ok := strings.CutPrefix(s, stat)
+		if !ok {
+			continue
+		}
+		for _, op := range thresholdOps {
+			if number, ok := strings.CutPrefix(rest, op); ok {
+				value, err := strconv.ParseFloat(number, 64)
+				return ThresholdRule{Stat: stat, Op: op, Value: value}, err == nil
+			}
+		}
+	}
+	return ThresholdRule{}, false
+}
+
+// envTLSVersion reads a minimum TLS version, 1.2 unless set. Versions
+// before 1.2 are refused as insecure.
+func envTLSVersion(key string) uint16 {
+	switch value := envString(key, "1.2"); value {
+	case "1.2":
+		return tls.VersionTLS12
+	case "1.3":
+		return tls.VersionTLS13
+	default:
+		invalidEnv(key, value, errors.New(`must be "1.2" or "1.3"`))
+		return 0
+	}
+}
+
+// envCipherSuites reads a comma-separated list of TLS 1.2 cipher suite
+// names, such as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Suites Go counts
+// as insecure are refused.
+func envCipherSuites(key string) []uint16 {
+	var ids []uint16
+	for _, name := range envList(key, nil) {
+		i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool {
+			return suite.Name == name
+		})
+		if i < 0 {
+			invalidEnv(key, name, errors.New("not a secure cipher suite"))
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids
+}
+
+// envPrefixList reads a comma-separated list of CIDR ranges. A bare address
+// stands for a range holding just that address.
+func envPrefixList(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range envList(key, nil) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			invalidEnv(key, item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// envDurationMap reads a comma-separated list of key=duration pairs.
+func envDurationMap(key string) map[string]time.Duration {
+	m := make(map[string]time.Duration)
+	for _, item := range envList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			invalidEnv(key, item, errors.New("expected key=duration"))
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			invalidEnv(key, item, err)
+		}
+		m[strings.TrimSpace(name)] = d
+	}
+	return m
+}
+
+func invalidEnv(key, value string, err error) {
+	panic(fmt.Errorf("invalid value %q for %s: %w", value, key, err))
+}
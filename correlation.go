@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+type correlationKey struct{}
+
+// maxCorrelationIDLen bounds client-supplied correlation IDs.
+const maxCorrelationIDLen = 128
+
+// correlationMiddleware takes the request's X-Correlation-ID, or generates
+// one if it has none or an unusable one, echoes it in the response and makes
+// it available to handlers through correlationID.
+func correlationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Correlation-ID")
+		if !validCorrelationID(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Correlation-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), correlationKey{}, id)))
+	})
+}
+
+// validCorrelationID accepts IDs of printable ASCII without spaces, so they
+// cannot break up a log line.
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func correlationID(r *http.Request) string {
+	id, _ := r.Context().Value(correlationKey{}).(string)
+	return id
+}
+
+// logf logs a line about r, tagged with its correlation ID.
+func logf(r *http.Request, format string, args ...any) {
+	logCorrelated(correlationID(r), format, args...)
+}
+
+func logCorrelated(id, format string, args ...any) {
+	if id == "" {
+		log.Printf(format, args...)
+		return
+	}
+	log.Printf("correlation=%s "+format, append([]any{id}, args...)...)
+}
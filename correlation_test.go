@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCorrelationID(t *testing.T) {
+	setup(t)
+	tests := []struct {
+		name, sent string
+		echoed     bool
+	}{
+		{"given", "order-42/attempt:1", true},
+		{"longest", strings.Repeat("x", maxCorrelationIDLen), true},
+		{"absent", "", false},
+		{"too long", strings.Repeat("x", maxCorrelationIDLen+1), false},
+		{"with a space", "order 42", false},
+		{"not ASCII", "ordér-42", false},
+	}
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.sent != "" {
+				headers = append(headers, "X-Correlation-ID: "+tt.sent)
+			}
+			got := request(t, http.MethodGet, "/statistics", "", headers...).Header().Get("X-Correlation-ID")
+			if tt.echoed {
+				if got != tt.sent {
+					t.Errorf("X-Correlation-ID %q, want %q echoed", got, tt.sent)
+				}
+				return
+			}
+			if b, err := hex.DecodeString(got); err != nil || len(b) != 16 || seen[got] {
+				t.Errorf("X-Correlation-ID %q, want a fresh 32-digit hex ID", got)
+			}
+			seen[got] = true
+		})
+	}
+}
+
+func TestCorrelationIDInWorkers(t *testing.T) {
+	var logged bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	setup(t, "WORKERS=1", "REJECT_DUPLICATE_TIMESTAMPS=true")
+	workerPool.start(config.Workers, config.WorkerQueue)
+	for _, id := range []string{"first", "second"} {
+		if w := request(t, http.MethodPost, "/transactions", tx("10", testStart), "X-Correlation-ID: "+id); w.Code != http.StatusAccepted {
+			t.Fatalf("POST /transactions: status %d: %s", w.Code, w.Body)
+		}
+	}
+	workerPool.stop()
+
+	if len(statsCache.queue) != 1 || statsCache.queue[0].correlationID != "first" {
+		t.Errorf("queue %v, want the first transaction tagged first", statsCache.queue)
+	}
+	if want := "correlation=second worker: dropped a transaction"; !strings.Contains(logged.String(), want) {
+		t.Errorf("log %q, want %q", logged.String(), want)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// countByHandler counts the in-window transactions per value of ?field=,
+// which is one of type, category, currency, city or source. Transactions
+// without a value for the field are left out.
+func countByHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	field := r.URL.Query().Get("field")
+	if _, ok := (&Transaction{}).field(field); !ok {
+		http.Error(w, "Unsupported field", http.StatusBadRequest)
+		return
+	}
+
+	flushWrites()
+
+	counts := make(map[string]int)
+
+	for _, t := range statsCache.Snapshot().inWindow(clock()) {
+		if value, _ := t.field(field); value != "" {
+			counts[value]++
+		}
+	}
+
+	json.NewEncoder(w).Encode(counts)
+}
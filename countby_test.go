@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"testing"
+)
+
+func TestCountBy(t *testing.T) {
+	setup(t)
+	setCity(t, "mysore")
+	post(t, tx("10", testStart, `"category":"food"`), http.StatusCreated)
+	setCity(t, "bangalore")
+	post(t, tx("20", testStart, `"category":"food"`), http.StatusCreated)
+	post(t, tx("30", testStart, `"category":"fuel"`), http.StatusCreated)
+	post(t, tx("40", testStart), http.StatusCreated)
+
+	tests := []struct {
+		field string
+		want  map[string]int
+	}{
+		{"category", map[string]int{"food": 2, "fuel": 1}},
+		{"city", map[string]int{"mysore": 1, "bangalore": 3}},
+		{"type", map[string]int{}},
+	}
+	for _, tt := range tests {
+		w := request(t, http.MethodGet, "/transactions/count-by?field="+tt.field, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("field=%s: status %d: %s", tt.field, w.Code, w.Body)
+		}
+		var counts map[string]int
+		if err := json.Unmarshal(w.Body.Bytes(), &counts); err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(counts, tt.want) {
+			t.Errorf("field=%s: %v, want %v", tt.field, counts, tt.want)
+		}
+	}
+
+	if w := request(t, http.MethodGet, "/transactions/count-by?field=amount", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	setCity(t, "mysore")
+	if w := request(t, http.MethodGet, "/transactions/count-by?field=city", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthorized location: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// isoCurrencies holds the active ISO 4217 alphabetic codes.
+var isoCurrencies = map[string]bool{}
+
+func init() {
+	const codes = "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BOV " +
+		"BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CLF CLP CNY COP COU CRC CUP CVE CZK " +
+		"DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD HNL " +
+		"HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT " +
+		"LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR " +
+		"MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF " +
+		"SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP " +
+		"TRY TTD TWD TZS UAH UGX USD USN UYI UYU UYW UZS VED VES VND VUV WST XAF XAG XAU " +
+		"XBA XBB XBC XBD XCD XDR XOF XPD XPF XPT XSU XTS XUA XXX YER ZAR ZMW ZWG"
+	for _, code := range strings.Fields(codes) {
+		isoCurrencies[code] = true
+	}
+}
+
+// currenciesHandler lists the currencies with live per-currency statistics,
+// in alphabetical order.
+func currenciesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !config.CurrencyStats {
+		http.Error(w, "Per-currency statistics are disabled", http.StatusNotFound)
+		return
+	}
+
+	flushWrites()
+
+	now := clock()
+	currencies := []string{}
+
+	statsCache.lock.RLock()
+	_, _, buckets := statsCache.buckets(now)
+	for code, bucket := range buckets {
+		if !expired(bucket.lastUpdated, now) {
+			currencies = append(currencies, code)
+		}
+	}
+	statsCache.lock.RUnlock()
+
+	slices.Sort(currencies)
+	json.NewEncoder(w).Encode(currencies)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCurrencyStats(t *testing.T) {
+	setup(t, "CURRENCY_STATS=true")
+	post(t, tx("10", testStart, `"currency":"INR"`), http.StatusCreated)
+	post(t, tx("30", testStart, `"currency":"INR"`), http.StatusCreated)
+	post(t, tx("5", testStart, `"currency":"USD"`), http.StatusCreated)
+	post(t, tx("1000", testStart), http.StatusCreated)
+	post(t, tx("1", testStart, `"currency":"inr"`), http.StatusUnprocessableEntity)
+
+	w := request(t, http.MethodGet, "/statistics/currencies", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var currencies []string
+	if err := json.Unmarshal(w.Body.Bytes(), &currencies); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"INR", "USD"}; !slices.Equal(currencies, want) {
+		t.Errorf("currencies %q, want %q", currencies, want)
+	}
+
+	tests := []struct {
+		currency string
+		count    int
+		sum      float64
+	}{
+		{"INR", 2, 40},
+		{"USD", 1, 5},
+		{"EUR", 0, 0},
+	}
+	for _, tt := range tests {
+		if stats := getStats(t, "/statistics?currency="+tt.currency); stats.Count != tt.count || stats.Sum != tt.sum {
+			t.Errorf("currency=%s: count %d and sum %v, want %d and %v", tt.currency, stats.Count, stats.Sum, tt.count, tt.sum)
+		}
+	}
+	if w := request(t, http.MethodGet, "/statistics?currency=EURO", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("currency=EURO: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	setCity(t, "mysore")
+	if w := request(t, http.MethodGet, "/statistics/currencies", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthorized location: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCurrencyStatsDisabled(t *testing.T) {
+	setup(t)
+	if w := request(t, http.MethodGet, "/statistics/currencies", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /statistics/currencies: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := request(t, http.MethodGet, "/statistics?currency=INR", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET /statistics?currency=INR: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed dashboard/index.html
+var dashboardFS embed.FS
+
+// dashboardHandler serves the embedded dashboard at / and 404s for any path
+// no other handler matched.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	http.ServeFileFS(w, r, dashboardFS, "dashboard/index.html")
+}
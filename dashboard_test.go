@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	setup(t)
+	w := request(t, http.MethodGet, "/", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, endpoint := range []string{"/statistics", "/transactions", "/location"} {
+		if !strings.Contains(w.Body.String(), endpoint) {
+			t.Errorf("dashboard does not use %s", endpoint)
+		}
+	}
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodHead, "/", http.StatusOK},
+		{http.MethodPost, "/", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := request(t, tt.method, tt.target, ""); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"net/http"
+)
+
+// debugBodiesMiddleware logs the request and response bodies of a
+// config.DebugBodySample fraction of requests, each cut short at
+// config.DebugBodyLimit bytes. The request body is teed as the handler
+// reads it, so the handler sees it unchanged.
+func debugBodiesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.DebugBodySample <= 0 || rand.Float64() >= config.DebugBodySample {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		request := &limitedBuffer{limit: config.DebugBodyLimit}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, request), r.Body}
+
+		response := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		response.body.limit = config.DebugBodyLimit
+
+		next.ServeHTTP(response, r)
+
+		logf(r, "debug: %s %s request %q%s response %d %q%s",
+			r.Method, r.URL.Path,
+			request.buf.Bytes(), request.suffix(),
+			response.status, response.body.buf.Bytes(), response.body.suffix())
+	})
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, reporting every write as complete.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) suffix() string {
+	if b.truncated {
+		return " (truncated)"
+	}
+	return ""
+}
+
+// bodyRecorder copies a response body into a limitedBuffer as it is
+// written.
+type bodyRecorder struct {
+	statusRecorder
+	body limitedBuffer
+}
+
+func (b *bodyRecorder) Write(p []byte) (int, error) {
+	b.body.Write(p)
+	return b.ResponseWriter.Write(p)
+}
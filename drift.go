@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// DriftCheck records the outcome of the most recent float drift check.
+type DriftCheck struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Drift     float64   `json:"drift"`
+	Corrected bool      `json:"corrected"`
+
+	pending int
+}
+
+// checkDrift compares the incrementally accumulated Sum against a compensated
+// re-summation of the queue plus everything evicted from it, and corrects Sum
+// when the two disagree by more than config.DriftTolerance. The caller must
+// hold the write lock.
+func (c *StatsCache) checkDrift(now time.Time) {
+	if config.DriftCheckEvery <= 0 || c.sampling() {
+		return
+	}
+	if c.drift.pending++; c.drift.pending < config.DriftCheckEvery {
+		return
+	}
+
+	amounts := make([]float64, 0, len(c.queue)+1)
+	for _, t := range c.queue {
+		amounts = append(amounts, t.Amount)
+	}
+	amounts = append(amounts, c.sumOffset)
+	exact := compensatedSum(amounts)
+
+	c.drift = DriftCheck{CheckedAt: now, Drift: c.stats.Sum - exact}
+	if math.Abs(c.drift.Drift) > config.DriftTolerance {
+		log.Printf("drift: sum %v differs from recomputed %v by %v, correcting", c.stats.Sum, exact, c.drift.Drift)
+		c.stats.Sum = exact
+		c.drift.Corrected = true
+	}
+}
+
+// compensatedSum adds values using Neumaier's variant of Kahan summation.
+func compensatedSum(values []float64) float64 {
+	var sum, compensation float64
+	for _, v := range values {
+		t := sum + v
+		if math.Abs(sum) >= math.Abs(v) {
+			compensation += (sum - t) + v
+		} else {
+			compensation += (v - t) + sum
+		}
+		sum = t
+	}
+	return sum + compensation
+}
+
+func driftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statsCache.lock.RLock()
+	drift := statsCache.drift
+	statsCache.lock.RUnlock()
+
+	json.NewEncoder(w).Encode(drift)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	// Ten additions of 0.1 come to 0.9999999999999999, against a correctly
+	// rounded 1.
+	tests := []struct {
+		tolerance string
+		corrected bool
+		sum       float64
+	}{
+		{"1e-9", false, 0.9999999999999999},
+		{"1e-17", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tolerance, func(t *testing.T) {
+			setup(t, "API_KEY=secret", "DRIFT_CHECK_EVERY=10", "DRIFT_TOLERANCE="+tt.tolerance)
+			for range 10 {
+				post(t, tx("0.1", testStart), http.StatusCreated)
+			}
+
+			w := request(t, http.MethodGet, "/debug/drift", "", "X-API-Key: secret")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var drift DriftCheck
+			if err := json.Unmarshal(w.Body.Bytes(), &drift); err != nil {
+				t.Fatal(err)
+			}
+			if drift.Drift == 0 || drift.Corrected != tt.corrected || !drift.CheckedAt.Equal(testStart) {
+				t.Errorf("%+v, want a drift corrected %v at %v", drift, tt.corrected, testStart)
+			}
+			if stats := getStats(t, "/statistics"); stats.Sum != tt.sum {
+				t.Errorf("sum %v, want %v", stats.Sum, tt.sum)
+			}
+		})
+	}
+}
+
+func TestDriftRequiresAPIKey(t *testing.T) {
+	setup(t)
+	if w := request(t, http.MethodGet, "/debug/drift", ""); w.Code != http.StatusForbidden {
+		t.Errorf("admin API disabled: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	setup(t, "API_KEY=secret")
+	if w := request(t, http.MethodGet, "/debug/drift", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportHandler streams every queued transaction within the retention
+// period as CSV. It works from a snapshot of the queue so that writers are
+// not held up while the rows are written out, and stops early if the client
+// goes away.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flushWrites()
+
+	now := clock()
+	limit := retention()
+
+	var txs []*Transaction
+	for _, t := range statsCache.Snapshot().Queue {
+		if now.Sub(t.Timestamp) <= limit {
+			txs = append(txs, t)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="transactions.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"timestamp", "amount", "type", "category", "currency", "city", "geohash", "source"})
+	for i, t := range txs {
+		amount := t.rawAmount
+		if amount == "" {
+			amount = strconv.FormatFloat(t.Amount, 'f', -1, 64)
+		}
+		out.Write([]string{t.Timestamp.Format(time.RFC3339Nano), amount, t.Type, t.Category, t.Currency, t.city, t.geohash, t.source})
+
+		if (i+1)%streamFlushEvery == 0 {
+			out.Flush()
+			if out.Error() != nil {
+				return
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+	out.Flush()
+}
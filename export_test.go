@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	tc := setup(t, "RETENTION=2m")
+	post(t, tx("1", testStart), http.StatusCreated)
+	tc.advance(90 * time.Second)
+	setCity(t, "bangalore")
+	if w := request(t, http.MethodPost, "/transactions", tx("12.50", tc.time(), `"type":"debit"`, `"category":"food"`, `"currency":"INR"`), "X-Source: till-4"); w.Code != http.StatusCreated {
+		t.Fatalf("POST /transactions: status %d: %s", w.Code, w.Body)
+	}
+
+	// The first transaction has now left the retention period, though
+	// nothing has been written since to evict it.
+	tc.advance(31 * time.Second)
+	w := request(t, http.MethodGet, "/transactions/export.csv", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("Content-Type %q, want text/csv", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="transactions.csv"` {
+		t.Errorf("Content-Disposition %q", got)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"timestamp", "amount", "type", "category", "currency", "city", "geohash", "source"},
+		{testStart.Add(90 * time.Second).Format(time.RFC3339Nano), "12.50", "debit", "food", "INR", "bangalore", "", "till-4"},
+	}
+	if !slices.EqualFunc(rows, want, slices.Equal) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+
+	setCity(t, "mysore")
+	if w := request(t, http.MethodGet, "/transactions/export.csv", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthorized location: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "strings"
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// maxGeohashPrecision is the longest geohash worth computing from float64
+// coordinates.
+const maxGeohashPrecision = 12
+
+// geohash encodes a latitude and longitude as a geohash of the given number
+// of characters.
+func geohash(lat, lng float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	bit, ch := 0, 0
+	even := true
+	for hash.Len() < precision {
+		r, v := &latRange, lat
+		if even {
+			r, v = &lngRange, lng
+		}
+		mid := (r[0] + r[1]) / 2
+		if v >= mid {
+			ch |= 1 << (4 - bit)
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		if bit++; bit == 5 {
+			hash.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+func validGeohash(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune(geohashAlphabet, c) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// locationGeohash returns the geohash of loc at config.GeohashPrecision, or
+// "" when the location has no coordinates.
+func locationGeohash(loc Location) string {
+	if loc.Latitude == nil || loc.Longitude == nil {
+		return ""
+	}
+	return geohash(*loc.Latitude, *loc.Longitude, config.GeohashPrecision)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{12.9716, 77.5946, 6, "tdr1v9"},
+		{0, 0, 1, "s"},
+		{-90, -180, 3, "000"},
+	}
+	for _, tt := range tests {
+		if got := geohash(tt.lat, tt.lng, tt.precision); got != tt.want {
+			t.Errorf("geohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lng, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestGeohashStats(t *testing.T) {
+	setup(t)
+	locate := func(body string) {
+		t.Helper()
+		if w := request(t, http.MethodPost, "/location", body); w.Code != http.StatusNoContent {
+			t.Fatalf("POST /location %s: status %d: %s", body, w.Code, w.Body)
+		}
+	}
+	// tdr1v9 and tdr1yh, then a location without coordinates.
+	locate(`{"city":"bangalore","lat":12.9716,"lng":77.5946}`)
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("20", testStart), http.StatusCreated)
+	locate(`{"city":"bangalore","lat":12.99,"lng":77.61}`)
+	post(t, tx("40", testStart), http.StatusCreated)
+	locate(`{"city":"bangalore"}`)
+	post(t, tx("1000", testStart), http.StatusCreated)
+
+	tests := []struct {
+		prefix string
+		count  int
+		sum    float64
+	}{
+		{"tdr1", 3, 70},
+		{"t", 3, 70},
+		{"tdr1v", 2, 30},
+		{"tdr1v9", 2, 30},
+		{"tdr1yh", 1, 40},
+		{"tdr2", 0, 0},
+	}
+	for _, tt := range tests {
+		if stats := getStats(t, "/statistics?geohash="+tt.prefix); stats.Count != tt.count || stats.Sum != tt.sum {
+			t.Errorf("geohash=%s: count %d and sum %v, want %d and %v", tt.prefix, stats.Count, stats.Sum, tt.count, tt.sum)
+		}
+	}
+
+	for _, prefix := range []string{"tdr1v9x", "tdr1a", "TDR1", "tdr-"} {
+		if w := request(t, http.MethodGet, "/statistics?geohash="+prefix, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("geohash=%s: status %d, want %d", prefix, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGeohashPrecision(t *testing.T) {
+	setup(t, "GEOHASH_PRECISION=4")
+	if w := request(t, http.MethodPost, "/location", `{"city":"bangalore","lat":12.9716,"lng":77.5946}`); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /location: status %d: %s", w.Code, w.Body)
+	}
+	post(t, tx("10", testStart), http.StatusCreated)
+	if stats := getStats(t, "/statistics?geohash=tdr1"); stats.Count != 1 {
+		t.Errorf("geohash=tdr1: count %d, want 1", stats.Count)
+	}
+	if w := request(t, http.MethodGet, "/statistics?geohash=tdr1v", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("finer than the precision: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	for _, precision := range []string{"0", "13"} {
+		t.Run(precision, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("GEOHASH_PRECISION=%s was accepted", precision)
+				}
+			}()
+			setup(t, "GEOHASH_PRECISION="+precision)
+		})
+	}
+}
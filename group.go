@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Page sizes for /statistics/group.
+const (
+	defaultGroupLimit = 100
+	maxGroupLimit     = 1000
+)
+
+// groupKeySeparator joins the field values of a composite group key.
+const groupKeySeparator = "|"
+
+type GroupStats struct {
+	Groups map[string]Stats `json:"groups"`
+
+	// Next is the ?after= that fetches the following page, and is empty
+	// on the last one.
+	Next string `json:"next,omitempty"`
+}
+
+// groupHandler aggregates the in-window transactions per combination of the
+// comma-separated ?by= fields, each one of those countByHandler supports.
+// Groups are keyed by their values joined with "|" in the order requested,
+// a missing value standing as the empty string. Keys are paged in sorted
+// order, ?limit= at a time, the next page starting after the key in ?after=.
+func groupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	fields := strings.Split(query.Get("by"), ",")
+	for _, field := range fields {
+		if _, ok := (&Transaction{}).field(field); !ok {
+			http.Error(w, "Unsupported field", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultGroupLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxGroupLimit {
+			http.Error(w, "Limit must be between 1 and "+strconv.Itoa(maxGroupLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	after := query.Get("after")
+
+	flushWrites()
+
+	groups := make(map[string]Stats)
+	values := make([]string, len(fields))
+	for _, t := range statsCache.Snapshot().inWindow(clock()) {
+		for i, field := range fields {
+			values[i], _ = t.field(field)
+		}
+		key := strings.Join(values, groupKeySeparator)
+		if after != "" && key <= after {
+			continue
+		}
+		stats := groups[key]
+		stats.add(t)
+		groups[key] = stats
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	result := GroupStats{Groups: make(map[string]Stats, min(len(keys), limit))}
+	for i, key := range keys {
+		if i == limit {
+			result.Next = keys[i-1]
+			break
+		}
+		stats := groups[key]
+		stats.derive()
+		result.Groups[key] = stats
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
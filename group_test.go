@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// getGroups reads /statistics/group with query.
+func getGroups(t *testing.T, query string) GroupStats {
+	t.Helper()
+	w := request(t, http.MethodGet, "/statistics/group?"+query, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /statistics/group?%s: status %d: %s", query, w.Code, w.Body)
+	}
+	var groups GroupStats
+	if err := json.Unmarshal(w.Body.Bytes(), &groups); err != nil {
+		t.Fatal(err)
+	}
+	return groups
+}
+
+func TestGroup(t *testing.T) {
+	setup(t)
+	setCity(t, "mysore")
+	post(t, tx("10", testStart, `"category":"food"`), http.StatusCreated)
+	setCity(t, "bangalore")
+	post(t, tx("20", testStart, `"category":"food"`), http.StatusCreated)
+	post(t, tx("40", testStart, `"category":"food"`), http.StatusCreated)
+	post(t, tx("5", testStart), http.StatusCreated)
+
+	// Keyed in the order asked for, a missing category standing empty.
+	groups := getGroups(t, "by=city,category")
+	want := map[string]Stats{
+		"bangalore|":     {Sum: 5, Count: 1},
+		"bangalore|food": {Sum: 60, Count: 2},
+		"mysore|food":    {Sum: 10, Count: 1},
+	}
+	if len(groups.Groups) != len(want) || groups.Next != "" {
+		t.Fatalf("%+v, want the groups %v on one page", groups, slices.Collect(maps.Keys(want)))
+	}
+	for key, stats := range want {
+		if got := groups.Groups[key]; got.Sum != stats.Sum || got.Count != stats.Count {
+			t.Errorf("%q: %+v, want count %d and sum %v", key, got, stats.Count, stats.Sum)
+		}
+	}
+	if got := getGroups(t, "by=category,city").Groups["food|bangalore"]; got.Count != 2 || got.Avg != 30 {
+		t.Errorf("food|bangalore: %+v, want two transactions averaging 30", got)
+	}
+
+	// Paged in key order.
+	var keys []string
+	query := "by=city,category&limit=2"
+	for page := 0; ; page++ {
+		groups := getGroups(t, query)
+		if len(groups.Groups) > 2 {
+			t.Errorf("page %d has %d groups, want at most 2", page, len(groups.Groups))
+		}
+		keys = append(keys, slices.Sorted(maps.Keys(groups.Groups))...)
+		if groups.Next == "" {
+			break
+		}
+		query = "by=city,category&limit=2&after=" + url.QueryEscape(groups.Next)
+	}
+	if want := []string{"bangalore|", "bangalore|food", "mysore|food"}; !slices.Equal(keys, want) {
+		t.Errorf("pages gave %q, want %q", keys, want)
+	}
+}
+
+func TestGroupParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"by=city", http.StatusOK},
+		{"by=source,type,currency", http.StatusOK},
+		{"", http.StatusBadRequest},
+		{"by=amount", http.StatusBadRequest},
+		{"by=city,", http.StatusBadRequest},
+		{"by=city,amount", http.StatusBadRequest},
+		{"by=city&limit=1000", http.StatusOK},
+		{"by=city&limit=1001", http.StatusBadRequest},
+		{"by=city&limit=0", http.StatusBadRequest},
+		{"by=city&limit=ten", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setup(t)
+			if w := request(t, http.MethodGet, "/statistics/group?"+tt.query, ""); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	setup(t)
+	setCity(t, "mysore")
+	if w := request(t, http.MethodGet, "/statistics/group?by=city", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthorized location: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
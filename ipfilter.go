@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// ipFilterMiddleware answers 403 to mutating requests from clients that
+// config.IPAllow does not cover, or that config.IPDeny does. An empty
+// allowlist allows every address not on the denylist.
+func ipFilterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(config.IPAllow) == 0 && len(config.IPDeny) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip, err := netip.ParseAddr(clientIP(r))
+		if err != nil || !ipAllowed(ip.Unmap()) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ipAllowed(ip netip.Addr) bool {
+	if containsAddr(config.IPDeny, ip) {
+		return false
+	}
+	return len(config.IPAllow) == 0 || containsAddr(config.IPAllow, ip)
+}
+
+func containsAddr(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
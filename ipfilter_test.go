@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	tests := []struct {
+		name, remote, forwarded string
+		env                     []string
+		want                    int
+	}{
+		{"no lists", "203.0.113.9", "", nil, http.StatusCreated},
+		{"allowed", "10.1.2.3", "", []string{"IP_ALLOW=10.0.0.0/8"}, http.StatusCreated},
+		{"not allowed", "203.0.113.9", "", []string{"IP_ALLOW=10.0.0.0/8"}, http.StatusForbidden},
+		{"single address", "203.0.113.9", "", []string{"IP_ALLOW=203.0.113.9"}, http.StatusCreated},
+		{"denied", "203.0.113.9", "", []string{"IP_DENY=203.0.113.0/24"}, http.StatusForbidden},
+		{"not denied", "198.51.100.1", "", []string{"IP_DENY=203.0.113.0/24"}, http.StatusCreated},
+		{"denied over allowed", "10.9.9.9", "", []string{"IP_ALLOW=10.0.0.0/8", "IP_DENY=10.9.0.0/16"}, http.StatusForbidden},
+		{"mapped IPv4", "[::ffff:10.1.2.3]", "", []string{"IP_ALLOW=10.0.0.0/8"}, http.StatusCreated},
+		// Behind a trusted proxy the client is the forwarded address, not
+		// the proxy's.
+		{"through a proxy", "192.168.0.1", "10.1.2.3", []string{"TRUSTED_PROXIES=192.168.0.0/16", "IP_ALLOW=10.0.0.0/8"}, http.StatusCreated},
+		{"denied through a proxy", "192.168.0.1", "203.0.113.9", []string{"TRUSTED_PROXIES=192.168.0.0/16", "IP_ALLOW=10.0.0.0/8,192.168.0.0/16"}, http.StatusForbidden},
+		{"untrusted proxy", "198.51.100.1", "10.1.2.3", []string{"TRUSTED_PROXIES=192.168.0.0/16", "IP_ALLOW=10.0.0.0/8"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			r := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(tx("10", testStart)))
+			r.RemoteAddr = tt.remote + ":4321"
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			w := httptest.NewRecorder()
+			newHandler().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// Reads are never filtered.
+	setup(t, "IP_ALLOW=10.0.0.0/8")
+	if w := request(t, http.MethodGet, "/statistics", ""); w.Code != http.StatusOK {
+		t.Errorf("GET from outside the allowlist: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
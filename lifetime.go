@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// startedAt is when the process started, which stands in for the last reset
+// until the first one.
+var startedAt = clock()
+
+// LifetimeStats covers everything since the last reset, unlike the windowed
+// statistics.
+type LifetimeStats struct {
+	Since         time.Time `json:"since"`
+	UptimeSeconds float64   `json:"uptimeSeconds"`
+	Processed     uint64    `json:"processed"`
+}
+
+func lifetimeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flushWrites()
+
+	statsCache.lock.RLock()
+	since := statsCache.resetAt
+	processed := statsCache.processed
+	statsCache.lock.RUnlock()
+
+	if since.IsZero() {
+		since = startedAt
+	}
+
+	json.NewEncoder(w).Encode(LifetimeStats{
+		Since:         since,
+		UptimeSeconds: clock().Sub(since).Seconds(),
+		Processed:     processed,
+	})
+}
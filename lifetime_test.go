@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func getLifetime(t *testing.T) LifetimeStats {
+	t.Helper()
+	w := request(t, http.MethodGet, "/statistics/lifetime", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /statistics/lifetime: status %d: %s", w.Code, w.Body)
+	}
+	var lifetime LifetimeStats
+	if err := json.Unmarshal(w.Body.Bytes(), &lifetime); err != nil {
+		t.Fatal(err)
+	}
+	return lifetime
+}
+
+func TestLifetime(t *testing.T) {
+	tc := setup(t)
+	for range 3 {
+		post(t, tx("10", tc.time()), http.StatusCreated)
+	}
+	if lifetime := getLifetime(t); lifetime.Processed != 3 || !lifetime.Since.Equal(startedAt) {
+		t.Errorf("%+v, want 3 processed since the process started", lifetime)
+	}
+
+	// The window empties but the lifetime count does not.
+	tc.advance(5 * time.Minute)
+	if stats := getStats(t, "/statistics"); stats.Count != 0 {
+		t.Errorf("window count %d, want 0", stats.Count)
+	}
+	post(t, tx("10", tc.time()), http.StatusCreated)
+	if lifetime := getLifetime(t); lifetime.Processed != 4 {
+		t.Errorf("processed %d after the window expired, want 4", lifetime.Processed)
+	}
+
+	// Only a reset starts it again.
+	resetAt := tc.time()
+	reset(t)
+	tc.advance(90 * time.Second)
+	post(t, tx("10", tc.time()), http.StatusCreated)
+	if lifetime := getLifetime(t); lifetime.Processed != 1 || !lifetime.Since.Equal(resetAt) || lifetime.UptimeSeconds != 90 {
+		t.Errorf("%+v, want 1 processed in the 90s since the reset at %v", lifetime, resetAt)
+	}
+
+	setCity(t, "mysore")
+	if w := request(t, http.MethodGet, "/statistics/lifetime", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthorized location: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
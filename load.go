@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// LoadResult is returned by POST /admin/load.
+type LoadResult struct {
+	Stats   Stats         `json:"stats"`
+	Loaded  int           `json:"loaded"`
+	Skipped []SkippedLoad `json:"skipped"`
+}
+
+// SkippedLoad explains why the transaction at Index was not loaded.
+type SkippedLoad struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// loadHandler resets the statistics and ingests a JSON array of
+// transactions under a single acquisition of the write lock, so no other
+// write can land between the reset and the load. Each transaction is checked
+// and tagged with the source, correlation ID and location as POST
+// /transactions would do, and those that fail the checks are skipped.
+func loadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var txs []Transaction
+	if !decodeJSON(w, r, &txs) {
+		return
+	}
+	auditNote(r, "%d transactions", len(txs))
+	source, correlation := requestSource(r), correlationID(r)
+
+	locationCache.lock.RLock()
+	city := locationCache.location.City
+	hash := locationGeohash(locationCache.location)
+	locationCache.lock.RUnlock()
+
+	// Buffered writes predate the reset and would be dropped anyway.
+	writeBuffer.take()
+
+	statsCache.resetting.Add(1)
+	defer statsCache.resetting.Add(-1)
+
+	statsCache.lock.Lock()
+	defer statsCache.lock.Unlock()
+
+	statsCache.reset()
+
+	now := clock()
+	result := LoadResult{Skipped: []SkippedLoad{}}
+	for i := range txs {
+		t := &txs[i]
+		t.generation = statsCache.generation.Load()
+		t.source = source
+		t.correlationID = correlation
+		t.city = city
+		t.geohash = hash
+		t.normalize(now)
+
+		if reason := loadProblem(t, now); reason != "" {
+			result.Skipped = append(result.Skipped, SkippedLoad{Index: i, Reason: reason})
+			continue
+		}
+		statsCache.accept(t, now)
+		result.Loaded++
+	}
+
+	result.Stats = statsCache.current(clock())
+	result.Stats.derive()
+	json.NewEncoder(w).Encode(result)
+}
+
+func loadProblem(t *Transaction, now time.Time) string {
+	if err := firstProblem(t, now); err != nil {
+		return err.Message
+	}
+	if t.expired(now) {
+		return "Transaction is older than the window"
+	}
+	_, problem := statsCache.admit(t, now)
+	return problem
+}
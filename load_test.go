@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	setup(t, "API_KEY=secret")
+	post(t, tx("1000", testStart), http.StatusCreated)
+
+	body := "[" + strings.Join([]string{
+		tx("10", testStart),
+		tx("20", testStart.Add(-10*time.Second)),
+		tx("30", testStart.Add(-2*time.Minute)),
+		tx("40", testStart.Add(time.Hour)),
+		tx("50", testStart, `"weight":-1`),
+	}, ",") + "]"
+	w := request(t, http.MethodPost, "/admin/load", body, "X-API-Key: secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var result LoadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Loaded != 2 || result.Stats.Count != 2 || result.Stats.Sum != 30 || result.Stats.Avg != 15 {
+		t.Errorf("loaded %d, stats %+v, want the two valid transactions only", result.Loaded, result.Stats)
+	}
+	want := []SkippedLoad{
+		{2, "Transaction is older than the window"},
+		{3, "Transaction timestamp is in the future"},
+		{4, "Transaction weight must not be negative"},
+	}
+	if len(result.Skipped) != len(want) {
+		t.Fatalf("skipped %+v, want %+v", result.Skipped, want)
+	}
+	for i := range want {
+		if result.Skipped[i] != want[i] {
+			t.Errorf("skipped %+v, want %+v", result.Skipped[i], want[i])
+		}
+	}
+
+	if stats := getStats(t, "/statistics"); stats.Count != 2 || stats.Sum != 30 {
+		t.Errorf("statistics %+v, want what was loaded", stats)
+	}
+}
+
+func TestLoadTagging(t *testing.T) {
+	setup(t, "API_KEY=secret")
+	setCity(t, "bangalore")
+	body := "[" + tx("10", testStart) + "," + tx("20", testStart) + "]"
+	if w := request(t, http.MethodPost, "/admin/load", body, "X-API-Key: secret", "X-Source: backfill", "X-Correlation-ID: load-1"); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	for _, queued := range statsCache.queue {
+		if queued.source != "backfill" || queued.correlationID != "load-1" || queued.city != "bangalore" {
+			t.Errorf("loaded with source %q, correlation ID %q and city %q", queued.source, queued.correlationID, queued.city)
+		}
+	}
+	if stats := getStats(t, "/statistics?source=backfill"); stats.Count != 2 {
+		t.Errorf("source=backfill: count %d, want 2", stats.Count)
+	}
+}
+
+func TestLoadRequiresAPIKey(t *testing.T) {
+	setup(t, "API_KEY=secret")
+	if w := request(t, http.MethodPost, "/admin/load", "[]"); w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -2,15 +2,61 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Transaction struct {
 	Amount    float64   `json:"amount"`
 	Timestamp time.Time `json:"timestamp"`
+
+	Type     string            `json:"type,omitempty"`
+	Category string            `json:"category,omitempty"`
+	Currency string            `json:"currency,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Weight scales the transaction's contribution to weighted statistics.
+	// Nil means a weight of 1.
+	Weight *float64 `json:"weight,omitempty"`
+
+	// SchemaVersion is the version of the payload shape; see schema.go.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
+	// generation is the StatsCache generation the transaction was
+	// accepted under.
+	generation uint64
+
+	// city and geohash describe the active location when the transaction
+	// was accepted. geohash is empty if the location had no coordinates.
+	city    string
+	geohash string
+
+	// ttl, from the optional "ttl" duration, replaces the window for this
+	// transaction alone. Zero means the window applies.
+	ttl time.Duration
+
+	// correlationID is the X-Correlation-ID of the request that sent it.
+	correlationID string
+
+	// asyncID identifies the transaction at /transactions/status/ while it
+	// is with the worker pool.
+	asyncID string
+
+	// source is the X-Source header or client IP the transaction came from.
+	source string
+
+	// rawAmount is the amount exactly as it appeared in the request, kept
+	// so validation can inspect it before float64 rounding.
+	rawAmount string
 }
 
 type Stats struct {
@@ -19,10 +65,93 @@ type Stats struct {
 	Max   float64 `json:"max"`
 	Min   float64 `json:"min"`
 	Count int     `json:"count"`
+
+	// First and Last are the amounts of the oldest and newest transactions
+	// by timestamp. Ties go to the earliest and latest accepted.
+	First float64 `json:"first"`
+	Last  float64 `json:"last"`
+
+	firstAt time.Time
+	lastAt  time.Time
+
+	// Sampled reports that the queue behind queue-derived endpoints is a
+	// sample; Sum and Count remain exact.
+	Sampled bool `json:"sampled,omitempty"`
+
+	// Warming is set while the post-reset warm-up period is running.
+	Warming bool `json:"warming,omitempty"`
+
+	// DecayedMax and DecayedMin are reported when config.DecayHalfLife is
+	// set; see decayExtremes.
+	DecayedMax *float64 `json:"decayedMax,omitempty"`
+	DecayedMin *float64 `json:"decayedMin,omitempty"`
+
+	// Median and P95 are the median and 95th percentile amounts in the
+	// window, reported when config.Median is set, P95 only for
+	// ?include=p95.
+	Median *float64 `json:"median,omitempty"`
+	P95    *float64 `json:"p95,omitempty"`
+
+	// WindowSeconds is the length of the window /statistics covered.
+	WindowSeconds float64 `json:"windowSeconds,omitempty"`
+
+	// InsufficientData is set in place of the numbers when the window holds
+	// fewer than config.MinTransactions transactions.
+	InsufficientData bool `json:"insufficientData,omitempty"`
+
+	// Cardinality is reported for ?include=cardinality.
+	Cardinality *Cardinality `json:"cardinality,omitempty"`
 }
 
 type Location struct {
-	City string `json:"city"`
+	City      string   `json:"city"`
+	Latitude  *float64 `json:"lat,omitempty"`
+	Longitude *float64 `json:"lng,omitempty"`
+}
+
+// equal reports whether l and other name the same city and coordinates.
+func (l Location) equal(other Location) bool {
+	return l.City == other.City && sameCoordinate(l.Latitude, other.Latitude) && sameCoordinate(l.Longitude, other.Longitude)
+}
+
+// validCoordinates reports whether the latitude and longitude, where given,
+// are within -90 to 90 and -180 to 180 degrees.
+func validCoordinates(lat, lng *float64) bool {
+	return (lat == nil || *lat >= -90 && *lat <= 90) && (lng == nil || *lng >= -180 && *lng <= 180)
+}
+
+func sameCoordinate(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// normalizeCity returns city in the form config.NormalizeCities stores and
+// compares, or unchanged when it is not set.
+func normalizeCity(city string) string {
+	if !config.NormalizeCities {
+		return city
+	}
+	return strings.Join(strings.Fields(strings.ToLower(city)), " ")
+}
+
+// LocationResult answers a POST /location that left the location as it was.
+type LocationResult struct {
+	Status string `json:"status"`
+}
+
+// LocationPatch carries the fields of a PATCH /location. Nil fields were not
+// provided and are left unchanged.
+type LocationPatch struct {
+	City      *string  `json:"city"`
+	Latitude  *float64 `json:"lat"`
+	Longitude *float64 `json:"lng"`
+}
+
+type StatsBucket struct {
+	lastUpdated time.Time
+	stats       Stats
 }
 
 type StatsCache struct {
@@ -30,6 +159,42 @@ type StatsCache struct {
 	lastUpdated time.Time
 	stats       Stats
 	queue       []*Transaction
+	cities      map[string]*StatsBucket
+	geohashes   map[string]*StatsBucket
+	currencies  map[string]*StatsBucket
+	resetAt     time.Time
+
+	// generation advances on every reset. Queued transactions from an
+	// earlier generation are never counted.
+	generation atomic.Uint64
+
+	// processed counts transactions accepted since the last reset,
+	// including those that have since left the window.
+	processed uint64
+
+	// resetting counts the resets requested and not yet finished, so
+	// writers can tell the client to retry.
+	resetting atomic.Int32
+
+	// offered counts transactions seen since the queue filled up to
+	// config.SampleSize, and is non-zero only while sampling.
+	offered int
+
+	// ttlQueue holds the transactions with their own TTL. They are kept out
+	// of the running statistics and buckets, which cannot drop a single
+	// transaction when its TTL ends, and merged in by current and buckets
+	// while they still count. Sampling never drops them.
+	ttlQueue []*Transaction
+
+	// sumOffset reconciles the queue with the running Sum, which should
+	// equal the queue total plus sumOffset. Evicting a transaction, or
+	// sampling leaving one out of the queue, adds its amount here.
+	sumOffset float64
+	drift     DriftCheck
+
+	median RollingMedian
+
+	cityCache CityStatsCache
 }
 
 type LocationCache struct {
@@ -37,126 +202,809 @@ type LocationCache struct {
 	location Location
 }
 
+// window is how far back a transaction may be timestamped and still count
+// towards the statistics. Both ends are inclusive: a transaction stamped
+// exactly now is accepted, and one exactly window old is still counted.
+// It holds a time.Duration and can be changed at runtime through
+// /admin/config/window; read it with statsWindow.
+var window atomic.Int64
+
+func statsWindow() time.Duration {
+	return time.Duration(window.Load())
+}
+
+// clock returns the current time in UTC. It is a variable so the reference
+// time can be pinned.
+var clock = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Window modes for config.WindowMode.
+const (
+	windowSliding  = "sliding"
+	windowTumbling = "tumbling"
+)
+
+// expired reports whether a transaction stamped at ts has fallen out of the
+// window at now. A sliding window ends a window after ts. A tumbling window
+// ends at the next multiple of the window since midnight UTC, or at midnight
+// if that comes first, so with a 1m window a transaction stamped at 10:00:59
+// counts for a second and one stamped at 10:00:00 for the whole minute.
+func expired(ts, now time.Time) bool {
+	if config.WindowMode == windowTumbling {
+		return ts.Before(truncateInDay(now, statsWindow()))
+	}
+	return now.Sub(ts) > statsWindow()
+}
+
+// retention is how long transactions stay in the queue: config.Retention,
+// but never less than the window.
+func retention() time.Duration {
+	return max(config.Retention, statsWindow())
+}
+
 var (
 	statsCache    StatsCache
 	locationCache LocationCache
 )
 
 func main() {
-	http.HandleFunc("/transactions", transactionsHandler)
-	http.HandleFunc("/statistics", statisticsHandler)
-	http.HandleFunc("/reset", resetHandler)
-	http.HandleFunc("/location", locationHandler)
-	http.HandleFunc("/location/reset", resetLocationHandler)
+	config = loadConfig()
+	window.Store(int64(config.Window))
+
+	if err := loadState(); err != nil {
+		log.Fatalf("loading %s: %v", config.StateFile, err)
+	}
 
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	if config.FlushInterval > 0 {
+		go flushPeriodically(config.FlushInterval)
+	}
+	if config.Workers > 0 {
+		workerPool.start(config.Workers, config.WorkerQueue)
+	}
+	if config.ResetEvery > 0 {
+		resetScheduler.start(config.ResetEvery)
+	}
+	if len(config.WebhookRules) > 0 {
+		events, _ := statsEvents.subscribe(64)
+		go watchThresholds(events, config.WebhookRules)
+	}
+
+	if err := serve(newHandler()); err != nil {
 		panic(err)
 	}
 }
 
+// newHandler routes the API and wraps it in the middleware.
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", dashboardHandler)
+	mux.HandleFunc("/transactions", transactionsHandler)
+	mux.HandleFunc("/transactions/count-by", countByHandler)
+	mux.HandleFunc("/transactions/validate", validateHandler)
+	mux.HandleFunc("/transactions/batch", batchHandler)
+	mux.HandleFunc("/transactions/status/", asyncStatusHandler)
+	mux.HandleFunc("/transactions/export.csv", exportHandler)
+	mux.HandleFunc("/statistics", cacheStats(statisticsHandler))
+	mux.HandleFunc("/statistics/timeseries", timeSeriesHandler)
+	mux.HandleFunc("/statistics/rollups", rollupsHandler)
+	mux.HandleFunc("/statistics/group", groupHandler)
+	mux.HandleFunc("/statistics/compute", computeHandler)
+	mux.HandleFunc("/statistics/lifetime", lifetimeHandler)
+	mux.HandleFunc("/statistics/currencies", currenciesHandler)
+	mux.HandleFunc("/reset", resetHandler)
+	mux.HandleFunc("/location", locationHandler)
+	mux.HandleFunc("/location/reset", resetLocationHandler)
+	mux.HandleFunc("/location/session", sessionHandler)
+	mux.HandleFunc("/admin/statistics", requireAPIKey(adminStatisticsHandler))
+	mux.HandleFunc("/admin/recompute", requireAPIKey(recomputeHandler))
+	mux.HandleFunc("/admin/config/window", requireAPIKey(windowConfigHandler))
+	mux.HandleFunc("/admin/audit", requireAPIKey(auditHandler))
+	mux.HandleFunc("/admin/load", requireAPIKey(loadHandler))
+	mux.HandleFunc("/admin/config", requireAPIKey(configHandler))
+	mux.HandleFunc("/debug/drift", requireAPIKey(driftHandler))
+	mux.HandleFunc("/metrics", metricsHandler)
+
+	// Middleware listed first runs innermost.
+	var handler http.Handler = mux
+	handler = timeoutMiddleware(handler)
+	handler = ipFilterMiddleware(handler)
+	handler = rateLimitMiddleware(handler)
+	handler = auditMiddleware(handler)
+	handler = debugBodiesMiddleware(handler)
+	handler = decompressMiddleware(handler)
+	handler = gzipMiddleware(handler)
+	handler = corsMiddleware(handler)
+	handler = correlationMiddleware(handler)
+	handler = serverTimeMiddleware(handler)
+
+	return handler
+}
+
 func transactionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		transactionCountHandler(w, r)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if statsCache.resetting.Load() > 0 {
+		resetConflict(w)
+		return
+	}
+
 	var transaction Transaction
-	err := json.NewDecoder(r.Body).Decode(&transaction)
-	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	transaction.generation = statsCache.generation.Load()
+	if !decodeJSON(w, r, &transaction) {
 		return
 	}
+	transaction.source = requestSource(r)
+	transaction.correlationID = correlationID(r)
+
+	now := clock()
+	transaction.normalize(now)
+	auditNote(r, "amount %v at %v", transaction.Amount, transaction.Timestamp.Format(time.RFC3339))
 
-	if transaction.Timestamp.After(time.Now().UTC()) {
-		http.Error(w, "Transaction timestamp is in the future", http.StatusUnprocessableEntity)
+	if err := firstProblem(&transaction, now); err != nil {
+		if transaction.Timestamp.After(now) {
+			metrics.observeFutureSkew(transaction.Timestamp.Sub(now))
+		}
+		http.Error(w, err.Message, err.Status)
 		return
 	}
 
-	if time.Since(transaction.Timestamp) > time.Second*60 {
-		w.WriteHeader(http.StatusNoContent)
+	if transaction.expired(now) {
+		metrics.observeStale()
+		if config.StaleStatus == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, "Transaction is older than the window and was not counted", config.StaleStatus)
+		return
+	}
+
+	locationCache.lock.RLock()
+	transaction.city = locationCache.location.City
+	transaction.geohash = locationGeohash(locationCache.location)
+	locationCache.lock.RUnlock()
+
+	if config.FlushInterval > 0 {
+		writeBuffer.add(&transaction)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	if config.Workers > 0 {
+		transaction.asyncID = asyncStatuses.track()
+		if !workerPool.offer(&transaction) {
+			asyncStatuses.finish(transaction.asyncID, asyncDropped, "The worker queue was full")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many transactions queued, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		if transaction.asyncID != "" {
+			w.Header().Set("Location", "/transactions/status/"+transaction.asyncID)
+		}
+		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
 	statsCache.lock.Lock()
 	defer statsCache.lock.Unlock()
 
-	statsCache.stats.Sum += transaction.Amount
-	statsCache.stats.Count++
-	if transaction.Amount > statsCache.stats.Max {
-		statsCache.stats.Max = transaction.Amount
+	if transaction.generation != statsCache.generation.Load() {
+		// A reset landed while the request was in flight.
+		resetConflict(w)
+		return
 	}
-	if statsCache.stats.Min == 0 || transaction.Amount < statsCache.stats.Min {
-		statsCache.stats.Min = transaction.Amount
+
+	if status, problem := statsCache.admit(&transaction, now); problem != "" {
+		http.Error(w, problem, status)
+		return
 	}
 
-	statsCache.lastUpdated = time.Now().UTC()
+	statsCache.accept(&transaction, now)
 
 	w.WriteHeader(http.StatusCreated)
 }
 
+// admit checks t against the constraints that depend on what is already
+// stored, returning the status and problem to report when it cannot be
+// accepted. The caller must hold the write lock.
+func (c *StatsCache) admit(t *Transaction, now time.Time) (int, string) {
+	if config.BucketOverflow == "reject" &&
+		(t.city != "" && !hasRoom(c.cities, t.city, now) ||
+			t.geohash != "" && !hasRoom(c.geohashes, t.geohash, now)) {
+		return http.StatusUnprocessableEntity, "Too many distinct locations"
+	}
+
+	if config.BucketOverflow == "reject" && config.CurrencyStats && t.Currency != "" && !hasRoom(c.currencies, t.Currency, now) {
+		return http.StatusUnprocessableEntity, "Too many distinct currencies"
+	}
+
+	if config.RejectDuplicateTimestamps && c.hasTimestamp(t.Timestamp, now) {
+		return http.StatusConflict, "A transaction with this timestamp already exists"
+	}
+
+	return 0, ""
+}
+
+// accept adds t to the running statistics, the queue and its buckets. The
+// caller must hold the write lock.
+func (c *StatsCache) accept(t *Transaction, now time.Time) {
+	if config.WindowMode == windowTumbling && !c.lastUpdated.IsZero() && expired(c.lastUpdated, now) {
+		c.rollover()
+	}
+	c.processed++
+	c.lastUpdated = now
+	c.retain(t, now)
+	if t.city != "" {
+		c.cityCache.invalidate(t.city)
+	}
+
+	if config.LazyStats {
+		metrics.observeAccepted()
+		statsEvents.publish(StatsEvent{Type: "accept", Time: now})
+		return
+	}
+
+	if config.Median {
+		c.median.add(t, now)
+	}
+
+	if t.ttl > 0 {
+		// It is queued but not in the running Sum.
+		c.ttlQueue = append(c.ttlQueue, t)
+		c.sumOffset -= t.Amount
+	} else {
+		c.stats.add(t)
+		c.cities, c.geohashes, c.currencies = addToBuckets([]*Transaction{t}, now, c.cities, c.geohashes, c.currencies)
+	}
+
+	c.checkDrift(now)
+	metrics.observeAccepted()
+	statsEvents.publish(StatsEvent{Type: "accept", Time: now, Stats: c.current(now)})
+}
+
+// transactionCountHandler answers HEAD /transactions with the number of
+// queued transactions inside the window in X-Transaction-Count.
+func transactionCountHandler(w http.ResponseWriter, r *http.Request) {
+	flushWrites()
+	now := clock()
+
+	statsCache.lock.RLock()
+	count := 0
+	for _, t := range statsCache.queue {
+		if !t.expired(now) {
+			count++
+		}
+	}
+	statsCache.lock.RUnlock()
+
+	w.Header().Set("X-Transaction-Count", strconv.Itoa(count))
+	w.WriteHeader(http.StatusOK)
+}
+
+// decodeJSON decodes the request body into v, writing a 400 response and
+// returning false when the body is empty or malformed.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if errors.Is(err, io.EOF) {
+		http.Error(w, "Request body is empty", http.StatusBadRequest)
+		return false
+	}
+	if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if errors.Is(err, errNullAmount) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if errors.Is(err, errSchemaVersion) || errors.Is(err, errAmountNotFinite) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// retain queues t for the queue-derived endpoints. With sampling enabled and
+// the queue full, it keeps a uniform sample using reservoir sampling.
+func (c *StatsCache) retain(t *Transaction, now time.Time) {
+	c.evict(now)
+
+	size := config.SampleSize
+	if size <= 0 || len(c.queue) < size {
+		c.offered = 0
+		c.queue = append(c.queue, t)
+		return
+	}
+
+	if c.offered == 0 {
+		c.offered = len(c.queue)
+	}
+	c.offered++
+	// Whichever transaction leaves the queue stays in the running Sum, so
+	// its amount goes to sumOffset as on eviction.
+	if i := rand.IntN(c.offered); i < size {
+		c.sumOffset += c.queue[i].Amount
+		c.queue[i] = t
+	} else {
+		c.sumOffset += t.Amount
+	}
+}
+
+func (c *StatsCache) sampling() bool {
+	return c.offered > 0
+}
+
+// evict drops queued transactions that are older than the retention period
+// or belong to an earlier generation.
+func (c *StatsCache) evict(now time.Time) {
+	generation := c.generation.Load()
+	limit := retention()
+	kept := c.queue[:0]
+	for _, t := range c.queue {
+		if now.Sub(t.Timestamp) <= limit && t.generation == generation {
+			kept = append(kept, t)
+		} else if t.generation == generation {
+			c.sumOffset += t.Amount
+		}
+	}
+	evicted := len(kept) < len(c.queue)
+	for i := len(kept); i < len(c.queue); i++ {
+		c.queue[i] = nil
+	}
+	c.queue = kept
+
+	live := c.liveTTL(now)
+	evicted = evicted || len(live) < len(c.ttlQueue)
+	c.ttlQueue = live
+
+	if evicted {
+		c.cityCache.clear()
+		event := StatsEvent{Type: "evict", Time: now}
+		if !config.LazyStats {
+			event.Stats = c.current(now)
+		}
+		statsEvents.publish(event)
+	}
+}
+
+func (s *Stats) add(t *Transaction) {
+	amount := t.Amount
+
+	if s.Count == 0 || t.Timestamp.Before(s.firstAt) {
+		s.First, s.firstAt = amount, t.Timestamp
+	}
+	if s.Count == 0 || !t.Timestamp.Before(s.lastAt) {
+		s.Last, s.lastAt = amount, t.Timestamp
+	}
+
+	if s.Count == 0 || amount > s.Max {
+		s.Max = amount
+	}
+	if s.Count == 0 || amount < s.Min {
+		s.Min = amount
+	}
+	s.Sum += amount
+	s.Count++
+}
+
 func statisticsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	locationCache.lock.RLock()
-	defer locationCache.lock.RUnlock()
-
-	if locationCache.location.City != "" && locationCache.location.City != "bangalore" {
+	if !locationAuthorized(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	flushWrites()
+
+	query := r.URL.Query()
+	meta := metadataFilter(query)
+	source := query.Get("source")
+
+	weighted := false
+	if raw := query.Get("weighted"); raw != "" {
+		var err error
+		if weighted, err = strconv.ParseBool(raw); err != nil {
+			http.Error(w, "Invalid weighted", http.StatusBadRequest)
+			return
+		}
+	}
+
+	compare := false
+	if raw := query.Get("compare"); raw != "" {
+		var err error
+		if compare, err = strconv.ParseBool(raw); err != nil {
+			http.Error(w, "Invalid compare", http.StatusBadRequest)
+			return
+		}
+	}
+	if compare && weighted {
+		http.Error(w, "compare cannot be combined with weighted", http.StatusBadRequest)
+		return
+	}
+	// The city, currency and geohash views come from buckets, which hold
+	// no per-transaction detail to filter, weight or compare by.
+	scopes := 0
+	for _, scope := range []string{"city", "currency", "geohash"} {
+		if query.Get(scope) != "" {
+			scopes++
+		}
+	}
+	filtered := len(meta) > 0 || source != "" || weighted || compare
+	if scopes > 1 {
+		http.Error(w, "city, currency and geohash cannot be combined", http.StatusBadRequest)
+		return
+	}
+	if scopes > 0 && filtered {
+		http.Error(w, "city, currency and geohash cannot be combined with metadata, source, weighted or compare", http.StatusBadRequest)
+		return
+	}
+	if units := query.Get("units"); units != "" && units != "cents" {
+		http.Error(w, "Invalid units", http.StatusBadRequest)
+		return
+	}
+	if inCents(r) && (weighted || compare) {
+		http.Error(w, "units=cents cannot be combined with weighted or compare", http.StatusBadRequest)
+		return
+	}
+	if fields, ok := projectedFields(r); !ok {
+		http.Error(w, "Unknown field, use one of "+strings.Join(statsFields, ", "), http.StatusBadRequest)
+		return
+	} else if fields != nil && (weighted || compare) {
+		http.Error(w, "fields cannot be combined with weighted or compare", http.StatusBadRequest)
+		return
+	}
+	if raw := query.Get("checksum"); raw != "" {
+		checksum, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "Invalid checksum", http.StatusBadRequest)
+			return
+		}
+		if checksum && (weighted || compare) {
+			http.Error(w, "checksum cannot be combined with weighted or compare", http.StatusBadRequest)
+			return
+		}
+	}
+	included, ok := includedOptions(r)
+	if !ok {
+		http.Error(w, "Invalid include, use "+strings.Join(includeOptions, ", "), http.StatusBadRequest)
+		return
+	}
+	cardinality := included["cardinality"]
+	if included["p95"] && (scopes > 0 || filtered) {
+		http.Error(w, "include=p95 is only available for the unfiltered statistics", http.StatusBadRequest)
+		return
+	}
+	include := func(stats Stats, match func(*Transaction) bool) Stats {
+		if !cardinality {
+			return stats
+		}
+		return withCardinality(stats, statsCache.filter(clock(), match))
+	}
+
+	if compare && retention() < 2*statsWindow() {
+		http.Error(w, "compare needs a retention of at least twice the window", http.StatusBadRequest)
+		return
+	}
+
+	// The 95th percentile needs the window sorted, which is done on a
+	// snapshot so the read lock below is not held for it.
+	var p95 *float64
+	if included["p95"] && config.Median {
+		p95 = windowP95(clock())
+	}
+
+	statsCache.lock.RLock()
+	defer statsCache.lock.RUnlock()
+
+	if clock().Sub(statsCache.resetAt) < config.WarmUp {
+		writeStatsBody(w, r, Stats{Warming: true})
+		return
+	}
+
+	staleHeaders(w, statsCache.lastUpdated, clock())
+
+	if city := query.Get("city"); city != "" {
+		if city != allCitiesKey {
+			http.Error(w, "Unsupported city, use * or /admin/statistics", http.StatusBadRequest)
+			return
+		}
+		bucket, _ := statsCache.cityStats(allCitiesKey, clock())
+		encodeStats(w, r, include(publicStats(bucket.stats), func(t *Transaction) bool { return t.city != "" }))
+		return
+	}
+
+	if currency := query.Get("currency"); currency != "" {
+		if !config.CurrencyStats {
+			http.Error(w, "Per-currency statistics are disabled", http.StatusBadRequest)
+			return
+		}
+		if !isoCurrencies[currency] {
+			http.Error(w, "Invalid currency", http.StatusBadRequest)
+			return
+		}
+		_, _, currencies := statsCache.buckets(clock())
+		bucket, ok := currencies[currency]
+		if !ok {
+			encodeStats(w, r, Stats{})
+			return
+		}
+		writeStats(w, r, include(publicStats(bucket.stats), func(t *Transaction) bool { return t.Currency == currency }), bucket.lastUpdated)
+		return
+	}
+
+	if prefix := query.Get("geohash"); prefix != "" {
+		if !validGeohash(prefix) || len(prefix) > config.GeohashPrecision {
+			http.Error(w, "Invalid geohash", http.StatusBadRequest)
+			return
+		}
+		_, geohashes, _ := statsCache.buckets(clock())
+		stats := publicStats(mergeBuckets(geohashes, clock(), func(key string) bool {
+			return strings.HasPrefix(key, prefix)
+		}))
+		encodeStats(w, r, include(stats, func(t *Transaction) bool { return strings.HasPrefix(t.geohash, prefix) }))
+		return
+	}
+
+	if filtered {
+		match := func(t *Transaction) bool {
+			return t.hasMetadata(meta) && (source == "" || t.source == source)
+		}
+		txs := statsCache.filter(clock(), match)
+		stats := publicStats(decayExtremes(aggregate(txs), txs, clock()))
+		stats.Sampled = statsCache.sampling()
+		if cardinality {
+			stats = withCardinality(stats, txs)
+		}
+		if weighted {
+			encodeWeightedStats(w, r, stats, txs)
+			return
+		}
+		if compare {
+			encodeCompareStats(w, stats, aggregate(statsCache.previousWindow(clock(), match)))
+			return
+		}
+		encodeStats(w, r, stats)
+		return
+	}
+
+	now := clock()
+	stats := statsCache.current(now)
+	if config.DecayHalfLife > 0 {
+		stats = decayExtremes(stats, statsCache.filter(now, func(*Transaction) bool { return true }), now)
+	}
+	stats = withMedian(stats, now)
+	stats.P95 = p95
+	stats = include(publicStats(stats), func(*Transaction) bool { return true })
+	stats.Sampled = statsCache.sampling()
+	encodeStats(w, r, stats)
+}
+
+// authorizedCities are the cities whose statistics may be read.
+var authorizedCities = []string{"bangalore"}
+
+// locationAuthorized reports whether the request may read statistics. The
+// city comes from the request's signed location cookie if it has one, and
+// from the shared location otherwise.
+func locationAuthorized(r *http.Request) bool {
+	city, err := sessionCity(r)
+	if errors.Is(err, errBadSession) {
+		return false
+	}
+	if errors.Is(err, errNoSession) {
+		locationCache.lock.RLock()
+		city = locationCache.location.City
+		locationCache.lock.RUnlock()
+	}
+
+	city = normalizeCity(city)
+	return city == "" || slices.ContainsFunc(authorizedCities, func(authorized string) bool {
+		return normalizeCity(authorized) == city
+	})
+}
+
+// adminStatisticsHandler serves the same numbers as /statistics without the
+// location gate. An optional ?city= narrows the result to a single city.
+func adminStatisticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	city := r.URL.Query().Get("city")
+
+	flushWrites()
+
 	statsCache.lock.RLock()
 	defer statsCache.lock.RUnlock()
 
-	if time.Since(statsCache.lastUpdated) > time.Second*60 {
-		fmt.Fprintf(w, "{}")
+	if city == "" {
+		stats := statsCache.current(clock())
+		stats.Sampled = statsCache.sampling()
+		encodeStats(w, r, stats)
+		return
+	}
+
+	if city == allCitiesKey {
+		bucket, _ := statsCache.cityStats(allCitiesKey, clock())
+		encodeStats(w, r, bucket.stats)
 		return
 	}
 
-	stats := statsCache.stats
-	stats.Avg = stats.Sum / float64(stats.Count)
+	bucket, ok := statsCache.cityStats(city, clock())
+	if !ok {
+		encodeStats(w, r, Stats{})
+		return
+	}
 
-	json.NewEncoder(w).Encode(stats)
+	writeStats(w, r, bucket.stats, bucket.lastUpdated)
 }
 
+// staleHeaders sends X-Stats-Age, the whole seconds since the statistics
+// were last updated, and a Warning once that age passes config.StaleWarning
+// of the window. Neither is sent when nothing has been recorded.
+func staleHeaders(w http.ResponseWriter, lastUpdated, now time.Time) {
+	if lastUpdated.IsZero() {
+		return
+	}
+	age := now.Sub(lastUpdated)
+	w.Header().Set("X-Stats-Age", strconv.Itoa(int(age.Seconds())))
+	if config.StaleWarning > 0 && !expired(lastUpdated, now) &&
+		age >= time.Duration(config.StaleWarning*float64(statsWindow())) {
+		w.Header().Set("Warning", `199 - "Statistics are about to go stale"`)
+	}
+}
+
+func writeStats(w http.ResponseWriter, r *http.Request, stats Stats, lastUpdated time.Time) {
+	if expired(lastUpdated, clock()) {
+		stats = Stats{}
+	}
+
+	encodeStats(w, r, stats)
+}
+
+// resetHandler clears the statistics, answering 204. With ?ifCountAtLeast=N
+// it only does so when the window holds at least N transactions, and answers
+// 412 without clearing anything otherwise. Simultaneous unconditional resets
+// are coalesced into one.
 func resetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	query := r.URL.Query()
+
+	minCount := 0
+	if raw := query.Get("ifCountAtLeast"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid ifCountAtLeast", http.StatusBadRequest)
+			return
+		}
+		minCount = n
+	}
+	if query.Get("dryRun") == "true" {
+		previewReset(w)
+		return
+	}
+
+	if config.ResetConfirmation {
+		switch {
+		case query.Get("force") == "true":
+			if !validAPIKey(r) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		case !resetTokens.redeem(query.Get("token"), clock()):
+			http.Error(w, "Reset requires a valid confirmation token from ?dryRun=true", http.StatusPreconditionRequired)
+			return
+		}
+	}
+
+	statsCache.resetting.Add(1)
+	defer statsCache.resetting.Add(-1)
+
+	if minCount == 0 {
+		resetFlight.reset()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	statsCache.lock.Lock()
 	defer statsCache.lock.Unlock()
 
-	statsCache.stats.Sum = 0
-	statsCache.stats.Avg = 0
-	statsCache.stats.Max = 0
-	statsCache.stats.Min = 0
-	statsCache.stats.Count = 0
-	statsCache.lastUpdated = time.Time{}
+	if statsCache.current(clock()).Count < minCount {
+		http.Error(w, "The window holds fewer transactions than ifCountAtLeast", http.StatusPreconditionFailed)
+		return
+	}
+
+	statsCache.reset()
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 var currentLocation Location
 
+const invalidCoordinates = "Latitude must be between -90 and 90 and longitude between -180 and 180"
+
 func locationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		patchLocationHandler(w, r)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var loc Location
-	err := json.NewDecoder(r.Body).Decode(&loc)
-	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeJSON(w, r, &loc) {
 		return
 	}
+	if !validCoordinates(loc.Latitude, loc.Longitude) {
+		http.Error(w, invalidCoordinates, http.StatusBadRequest)
+		return
+	}
+	loc.City = normalizeCity(loc.City)
 
+	locationCache.lock.Lock()
+	if config.DedupLocation && locationCache.location.equal(loc) {
+		locationCache.lock.Unlock()
+		auditNote(r, "city %q unchanged", loc.City)
+		json.NewEncoder(w).Encode(LocationResult{Status: "unchanged"})
+		return
+	}
+	auditNote(r, "city %q", loc.City)
 	locationCache.location = loc
+	saveLocation(locationCache.location)
+	locationCache.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func patchLocationHandler(w http.ResponseWriter, r *http.Request) {
+	var patch LocationPatch
+	if !decodeJSON(w, r, &patch) {
+		return
+	}
+	if !validCoordinates(patch.Latitude, patch.Longitude) {
+		http.Error(w, invalidCoordinates, http.StatusBadRequest)
+		return
+	}
+	if patch.City != nil {
+		*patch.City = normalizeCity(*patch.City)
+		auditNote(r, "city %q", *patch.City)
+	}
+
+	locationCache.lock.Lock()
+	if patch.City != nil {
+		locationCache.location.City = *patch.City
+	}
+	if patch.Latitude != nil {
+		locationCache.location.Latitude = patch.Latitude
+	}
+	if patch.Longitude != nil {
+		locationCache.location.Longitude = patch.Longitude
+	}
+	saveLocation(locationCache.location)
+	locationCache.lock.Unlock()
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -167,7 +1015,10 @@ func resetLocationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	locationCache.lock.Lock()
 	locationCache.location = Location{}
+	saveLocation(locationCache.location)
+	locationCache.lock.Unlock()
 
 	w.WriteHeader(http.StatusNoContent)
 }
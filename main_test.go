@@ -0,0 +1,629 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStart is where every test pins the clock.
+var testStart = time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+// testClock is the pinned clock. Tests move it on themselves.
+type testClock struct {
+	now atomic.Int64
+}
+
+func (c *testClock) time() time.Time {
+	return time.Unix(0, c.now.Load()).UTC()
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.now.Add(int64(d))
+}
+
+// setup loads the configuration from the defaults and the "KEY=value" env
+// pairs, clears all server state and pins the clock at testStart.
+func setup(t testing.TB, env ...string) *testClock {
+	t.Helper()
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		t.Setenv(key, value)
+	}
+
+	tc := &testClock{}
+	tc.now.Store(testStart.UnixNano())
+	previous := clock
+	clock = tc.time
+	t.Cleanup(func() { clock = previous })
+
+	config = loadConfig()
+	window.Store(int64(config.Window))
+
+	statsCache = StatsCache{}
+	locationCache = LocationCache{}
+	metrics = IngestionMetrics{futureSkew: make([]int, len(futureSkewBuckets)+1)}
+	statsEvents = Broadcaster{}
+	writeBuffer = WriteBuffer{}
+	workerPool = WorkerPool{}
+	asyncStatuses = AsyncStatuses{}
+	auditLog = AuditLog{}
+	resetTokens = ResetTokens{}
+	resetFlight = ResetFlight{}
+	rateLimiter = RateLimiter{}
+	resetScheduler = ResetScheduler{}
+	return tc
+}
+
+// request sends a request through the full handler, with headers given as
+// "Name: value".
+func request(t testing.TB, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ": ")
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	newHandler().ServeHTTP(w, r)
+	return w
+}
+
+// tx is the body of a transaction of amount stamped at ts, with any extra
+// members given as JSON, such as `"currency":"USD"`.
+func tx(amount string, ts time.Time, extra ...string) string {
+	members := append([]string{`"amount":` + amount, `"timestamp":"` + ts.Format(time.RFC3339Nano) + `"`}, extra...)
+	return "{" + strings.Join(members, ",") + "}"
+}
+
+// post sends body to POST /transactions and checks the status.
+func post(t testing.TB, body string, want int) *httptest.ResponseRecorder {
+	t.Helper()
+	w := request(t, http.MethodPost, "/transactions", body)
+	if w.Code != want {
+		t.Fatalf("POST /transactions %s: status %d, want %d: %s", body, w.Code, want, w.Body)
+	}
+	return w
+}
+
+// getStats reads target, /statistics or a variant of it, as JSON.
+func getStats(t testing.TB, target string) Stats {
+	t.Helper()
+	w := request(t, http.MethodGet, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, w.Code, w.Body)
+	}
+	var stats Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("GET %s: %v: %s", target, err, w.Body)
+	}
+	return stats
+}
+
+func TestEmptyBody(t *testing.T) {
+	for _, target := range []string{"/transactions", "/location"} {
+		for name, body := range map[string]string{"empty": "", "whitespace": " \n\t "} {
+			t.Run(target+"/"+name, func(t *testing.T) {
+				setup(t)
+				w := request(t, http.MethodPost, target, body)
+				if w.Code != http.StatusBadRequest || strings.TrimSpace(w.Body.String()) != "Request body is empty" {
+					t.Errorf("status %d, body %q", w.Code, w.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestMalformedBody(t *testing.T) {
+	setup(t)
+	w := request(t, http.MethodPost, "/transactions", "{")
+	if w.Code != http.StatusBadRequest || strings.TrimSpace(w.Body.String()) != "Invalid JSON" {
+		t.Errorf("status %d, body %q", w.Code, w.Body)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	setup(t, "SAMPLE_SIZE=200", "MEDIAN=true")
+	const n = 5000
+	for i := 1; i <= n; i++ {
+		post(t, tx(strconv.Itoa(i), testStart), http.StatusCreated)
+	}
+
+	if size := len(statsCache.Snapshot().Queue); size != 200 {
+		t.Errorf("queue holds %d transactions, want 200", size)
+	}
+
+	stats := getStats(t, "/statistics?include=p95")
+	if stats.Count != n || stats.Sum != n*(n+1)/2 {
+		t.Errorf("count %d, sum %v, want %d and %d", stats.Count, stats.Sum, n, n*(n+1)/2)
+	}
+	if !stats.Sampled {
+		t.Error("sampled not reported")
+	}
+
+	// The exact 95th percentile is 4750.05. A uniform sample of 200 puts
+	// it within 400 of that all but once in a few million runs.
+	if stats.P95 == nil || math.Abs(*stats.P95-4750.05) > 400 {
+		t.Errorf("p95 %v, want about 4750", stats.P95)
+	}
+
+	// Every transaction left out of the sample is in sumOffset.
+	total := statsCache.sumOffset
+	for _, queued := range statsCache.queue {
+		total += queued.Amount
+	}
+	if total != statsCache.stats.Sum {
+		t.Errorf("queue and sumOffset total %v, running sum %v", total, statsCache.stats.Sum)
+	}
+}
+
+func TestPatchLocation(t *testing.T) {
+	setup(t)
+	if w := request(t, http.MethodPost, "/location", `{"city":"bangalore","lat":12.97,"lng":77.59}`); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /location: status %d: %s", w.Code, w.Body)
+	}
+	if w := request(t, http.MethodPatch, "/location", `{"city":"mysore"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH /location: status %d: %s", w.Code, w.Body)
+	}
+
+	loc := locationCache.location
+	if loc.City != "mysore" || loc.Latitude == nil || *loc.Latitude != 12.97 || loc.Longitude == nil || *loc.Longitude != 77.59 {
+		t.Errorf("location %+v, want mysore at 12.97, 77.59", loc)
+	}
+}
+
+func TestLocationCoordinates(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"city":"bangalore","lat":90,"lng":-180}`, http.StatusNoContent},
+		{`{"city":"bangalore","lat":90.5,"lng":0}`, http.StatusBadRequest},
+		{`{"city":"bangalore","lat":-91,"lng":0}`, http.StatusBadRequest},
+		{`{"city":"bangalore","lat":0,"lng":180.5}`, http.StatusBadRequest},
+		{`{"city":"bangalore","lng":-181}`, http.StatusBadRequest},
+		{`{"city":"bangalore"}`, http.StatusNoContent},
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		for _, tt := range tests {
+			t.Run(method+" "+tt.body, func(t *testing.T) {
+				setup(t)
+				w := request(t, method, "/location", tt.body)
+				if w.Code != tt.want {
+					t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+				if w.Code == http.StatusBadRequest && locationCache.location.City != "" {
+					t.Errorf("rejected location was stored: %+v", locationCache.location)
+				}
+			})
+		}
+	}
+}
+
+func TestWindowBoundary(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   time.Time
+		want int
+	}{
+		{"now", testStart, http.StatusCreated},
+		{"future", testStart.Add(time.Nanosecond), http.StatusUnprocessableEntity},
+		{"window old", testStart.Add(-time.Minute), http.StatusCreated},
+		{"past the window", testStart.Add(-time.Minute - time.Nanosecond), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			post(t, tx("10", tt.ts), tt.want)
+		})
+	}
+
+	t.Run("counted", func(t *testing.T) {
+		tc := setup(t)
+		post(t, tx("10", testStart), http.StatusCreated)
+		tc.advance(time.Minute)
+		if stats := getStats(t, "/statistics"); stats.Count != 1 {
+			t.Errorf("window old: count %d, want 1", stats.Count)
+		}
+		tc.advance(time.Nanosecond)
+		if stats := getStats(t, "/statistics"); stats.Count != 0 {
+			t.Errorf("past the window: count %d, want 0", stats.Count)
+		}
+	})
+}
+
+func TestWindowMode(t *testing.T) {
+	// With an 11m window the tumbling intervals start at 09:54 and 10:05, since
+	// 11m does not divide the 600 minutes to 10:00. A sliding window keeps the
+	// running statistics until the last write, at 10:00:30, is a window old.
+	type check struct {
+		after time.Duration
+		count int
+	}
+	tests := []struct {
+		mode   string
+		checks []check
+	}{
+		{windowSliding, []check{
+			{5*time.Minute - time.Nanosecond, 2},
+			{5 * time.Minute, 2},
+			{11*time.Minute + 30*time.Second, 2},
+			{11*time.Minute + 30*time.Second + time.Nanosecond, 0},
+		}},
+		{windowTumbling, []check{
+			{5*time.Minute - time.Nanosecond, 2},
+			{5 * time.Minute, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			for _, c := range tt.checks {
+				tc := setup(t, "WINDOW=11m", "WINDOW_MODE="+tt.mode)
+				post(t, tx("10", testStart), http.StatusCreated)
+				tc.advance(30 * time.Second)
+				post(t, tx("20", tc.time()), http.StatusCreated)
+				tc.advance(c.after - 30*time.Second)
+				if stats := getStats(t, "/statistics"); stats.Count != c.count {
+					t.Errorf("after %v: count %d, want %d", c.after, stats.Count, c.count)
+				}
+			}
+		})
+	}
+
+	t.Run("rollover", func(t *testing.T) {
+		tc := setup(t, "WINDOW=11m", "WINDOW_MODE="+windowTumbling)
+		post(t, tx("10", testStart), http.StatusCreated)
+		tc.advance(5 * time.Minute)
+		post(t, tx("30", tc.time()), http.StatusCreated)
+		if stats := getStats(t, "/statistics"); stats.Count != 1 || stats.Sum != 30 || stats.Max != 30 {
+			t.Errorf("new interval: %+v, want only the transaction at 10:05", stats)
+		}
+	})
+}
+
+func TestFirstAndLast(t *testing.T) {
+	setup(t)
+	if stats := getStats(t, "/statistics"); stats.First != 0 || stats.Last != 0 {
+		t.Errorf("empty window: first %v, last %v, want 0", stats.First, stats.Last)
+	}
+
+	for _, body := range []string{
+		tx("10", testStart.Add(-30*time.Second)),
+		tx("20", testStart.Add(-50*time.Second)),
+		tx("30", testStart.Add(-10*time.Second)),
+		tx("40", testStart.Add(-10*time.Second)),
+		tx("50", testStart.Add(-50*time.Second)),
+	} {
+		post(t, body, http.StatusCreated)
+	}
+
+	// Ties go to the earliest accepted for First and the latest for Last.
+	if stats := getStats(t, "/statistics"); stats.First != 20 || stats.Last != 40 {
+		t.Errorf("first %v, last %v, want 20 and 40", stats.First, stats.Last)
+	}
+}
+
+func TestDuplicateTimestamps(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		env  []string
+		want int
+	}{
+		{"default", nil, http.StatusCreated},
+		{"strict", []string{"REJECT_DUPLICATE_TIMESTAMPS=true"}, http.StatusConflict},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			post(t, tx("10", testStart), http.StatusCreated)
+			post(t, tx("20", testStart), tt.want)
+			post(t, tx("30", testStart.Add(-time.Nanosecond)), http.StatusCreated)
+		})
+	}
+}
+
+func TestStaleStatus(t *testing.T) {
+	const explanation = "Transaction is older than the window and was not counted"
+	tests := []struct {
+		env  []string
+		want int
+		body string
+	}{
+		{nil, http.StatusNoContent, ""},
+		{[]string{"STALE_STATUS=202"}, http.StatusAccepted, explanation},
+		{[]string{"STALE_STATUS=422"}, http.StatusUnprocessableEntity, explanation},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.want), func(t *testing.T) {
+			setup(t, tt.env...)
+			w := post(t, tx("10", testStart.Add(-2*time.Minute)), tt.want)
+			if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+			if stats := getStats(t, "/statistics"); stats.Count != 0 {
+				t.Errorf("count %d, want 0", stats.Count)
+			}
+		})
+	}
+}
+
+// setCity posts city as the location.
+func setCity(t testing.TB, city string) {
+	t.Helper()
+	if w := request(t, http.MethodPost, "/location", `{"city":"`+city+`"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /location %s: status %d: %s", city, w.Code, w.Body)
+	}
+}
+
+func TestAllCities(t *testing.T) {
+	setup(t)
+	setCity(t, "mysore")
+	post(t, tx("5", testStart), http.StatusCreated)
+	post(t, tx("50", testStart), http.StatusCreated)
+	setCity(t, "bangalore")
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("30", testStart), http.StatusCreated)
+	setCity(t, "")
+	post(t, tx("1000", testStart), http.StatusCreated)
+
+	// The union of the cities, not the average of their averages, and
+	// nothing sent without a city.
+	stats := getStats(t, "/statistics?city=*")
+	if stats.Count != 4 || stats.Sum != 95 || stats.Avg != 23.75 || stats.Max != 50 || stats.Min != 5 {
+		t.Errorf("%+v, want 4 transactions summing to 95 from 5 to 50", stats)
+	}
+}
+
+func TestConcurrentCities(t *testing.T) {
+	setup(t, "API_KEY=secret")
+	cities := []string{"bangalore", "mysore", "delhi", "pune"}
+
+	// Each writer sends its own amount, so a transaction counted under the
+	// wrong city shows in the sums as well as the counts.
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if w := request(t, http.MethodPost, "/transactions", tx(strconv.Itoa(i+1), testStart)); w.Code != http.StatusCreated {
+					t.Errorf("POST /transactions: status %d: %s", w.Code, w.Body)
+				}
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if w := request(t, http.MethodPost, "/location", `{"city":"`+cities[i]+`"}`); w.Code != http.StatusNoContent {
+					t.Errorf("POST /location: status %d: %s", w.Code, w.Body)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Which city each transaction got depends on the race with the location
+	// writers, but it is recorded on the transaction in the queue, and each
+	// city's statistics must match exactly those transactions.
+	counts := make(map[string]int)
+	sums := make(map[string]float64)
+	for _, queued := range statsCache.queue {
+		counts[queued.city]++
+		sums[queued.city] += queued.Amount
+	}
+	if len(statsCache.queue) != 400 {
+		t.Errorf("%d queued, want the 400 sent", len(statsCache.queue))
+	}
+	for _, city := range cities {
+		w := request(t, http.MethodGet, "/admin/statistics?city="+city, "", "X-API-Key: secret")
+		var stats Stats
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Count != counts[city] || stats.Sum != sums[city] {
+			t.Errorf("%s: count %d and sum %v, want %d and %v", city, stats.Count, stats.Sum, counts[city], sums[city])
+		}
+	}
+	setCity(t, "bangalore")
+	if all := getStats(t, "/statistics?city=*"); all.Count != 400-counts[""] {
+		t.Errorf("?city=* counts %d, want the %d sent with a city", all.Count, 400-counts[""])
+	}
+}
+
+// BenchmarkAcceptByCity compares writers to one city with writers to
+// several. They take the same global lock, so spreading them over cities
+// does not help.
+func BenchmarkAcceptByCity(b *testing.B) {
+	for _, cities := range []int{1, 8} {
+		b.Run(strconv.Itoa(cities)+" cities", func(b *testing.B) {
+			setup(b, "RETENTION=1h")
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				city := "city" + strconv.Itoa(int(next.Add(1))%cities)
+				for pb.Next() {
+					t := &Transaction{Amount: 1, Timestamp: testStart, city: city}
+					statsCache.lock.Lock()
+					statsCache.accept(t, testStart)
+					statsCache.lock.Unlock()
+				}
+			})
+		})
+	}
+}
+
+func TestMaxAndMinOfOneSign(t *testing.T) {
+	tests := []struct {
+		name     string
+		amounts  []string
+		max, min float64
+	}{
+		{"negative", []string{"-5", "-2", "-9"}, -2, -9},
+		{"positive", []string{"5", "2", "9"}, 9, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			for _, amount := range tt.amounts {
+				post(t, tx(amount, testStart), http.StatusCreated)
+			}
+			if stats := getStats(t, "/statistics"); stats.Max != tt.max || stats.Min != tt.min {
+				t.Errorf("max %v and min %v, want %v and %v", stats.Max, stats.Min, tt.max, tt.min)
+			}
+		})
+	}
+}
+
+func TestStaleHeaders(t *testing.T) {
+	tc := setup(t, "STALE_WARNING=0.8")
+	if w := request(t, http.MethodGet, "/statistics", ""); w.Header().Get("X-Stats-Age") != "" || w.Header().Get("Warning") != "" {
+		t.Errorf("headers sent before any transaction: %v", w.Header())
+	}
+
+	post(t, tx("10", testStart), http.StatusCreated)
+	const warning = `199 - "Statistics are about to go stale"`
+	tests := []struct {
+		age        time.Duration
+		statsAge   string
+		warningSet bool
+	}{
+		{0, "0", false},
+		{47*time.Second + 900*time.Millisecond, "47", false},
+		{48 * time.Second, "48", true},
+		{60 * time.Second, "60", true},
+		{61 * time.Second, "61", false},
+	}
+	elapsed := time.Duration(0)
+	for _, tt := range tests {
+		tc.advance(tt.age - elapsed)
+		elapsed = tt.age
+		w := request(t, http.MethodGet, "/statistics", "")
+		if got := w.Header().Get("X-Stats-Age"); got != tt.statsAge {
+			t.Errorf("at %v: X-Stats-Age %q, want %q", tt.age, got, tt.statsAge)
+		}
+		if got := w.Header().Get("Warning"); (got == warning) != tt.warningSet || got != "" && got != warning {
+			t.Errorf("at %v: Warning %q", tt.age, got)
+		}
+	}
+}
+
+func TestDedupLocation(t *testing.T) {
+	const body = `{"city":"bangalore","lat":12.97,"lng":77.59}`
+	tests := []struct {
+		name      string
+		env       []string
+		want      int
+		summaries []string
+	}{
+		{"default", nil, http.StatusNoContent, []string{`city "bangalore"`, `city "bangalore"`}},
+		{"dedup", []string{"DEDUP_LOCATION=true"}, http.StatusOK, []string{`city "bangalore"`, `city "bangalore" unchanged`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, append(tt.env, "STATE_FILE="+filepath.Join(t.TempDir(), "state.json"))...)
+			if w := request(t, http.MethodPost, "/location", body); w.Code != http.StatusNoContent {
+				t.Fatalf("first POST: status %d: %s", w.Code, w.Body)
+			}
+			info, err := os.Stat(config.StateFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := request(t, http.MethodPost, "/location", body)
+			if w.Code != tt.want {
+				t.Fatalf("second POST: status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusOK && strings.TrimSpace(w.Body.String()) != `{"status":"unchanged"}` {
+				t.Errorf("second POST: body %s", w.Body)
+			}
+			if again, err := os.Stat(config.StateFile); err != nil || os.SameFile(info, again) != (tt.want == http.StatusOK) {
+				t.Errorf("state file rewritten %v, want %v", !os.SameFile(info, again), tt.want != http.StatusOK)
+			}
+
+			entries := auditLog.snapshot()
+			if len(entries) != len(tt.summaries) {
+				t.Fatalf("audit entries %+v, want %d", entries, len(tt.summaries))
+			}
+			for i, entry := range entries {
+				if entry.Summary != tt.summaries[i] {
+					t.Errorf("audit entry %d: %q, want %q", i, entry.Summary, tt.summaries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeCities(t *testing.T) {
+	tests := []struct {
+		city string
+		env  []string
+		want int
+	}{
+		{"bangalore", nil, http.StatusOK},
+		{"Bangalore", nil, http.StatusUnauthorized},
+		{"Bangalore", []string{"NORMALIZE_CITIES=true"}, http.StatusOK},
+		{" bangalore\t", []string{"NORMALIZE_CITIES=true"}, http.StatusOK},
+		{"  BANGALORE  ", []string{"NORMALIZE_CITIES=true"}, http.StatusOK},
+		{"bang alore", []string{"NORMALIZE_CITIES=true"}, http.StatusUnauthorized},
+		{"mysore", []string{"NORMALIZE_CITIES=true"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.city), func(t *testing.T) {
+			setup(t, tt.env...)
+			body, _ := json.Marshal(Location{City: tt.city})
+			if w := request(t, http.MethodPost, "/location", string(body)); w.Code != http.StatusNoContent {
+				t.Fatalf("POST /location: status %d: %s", w.Code, w.Body)
+			}
+			if w := request(t, http.MethodGet, "/statistics", ""); w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLazyStats(t *testing.T) {
+	tc := setup(t, "LAZY_STATS=true", "WINDOW=10s", "MEDIAN=true")
+	for i := range 100 {
+		post(t, tx(strconv.Itoa(i), tc.time()), http.StatusCreated)
+		tc.advance(time.Second)
+	}
+
+	// Only the last 10s are queued: 90 to 99, the first of which is
+	// exactly a window old.
+	if size := len(statsCache.Snapshot().Queue); size > 11 {
+		t.Errorf("queue holds %d transactions, want at most 11", size)
+	}
+	stats := getStats(t, "/statistics")
+	if stats.Count != 10 || stats.Sum != 945 || stats.Max != 99 || stats.Min != 90 || stats.Median == nil || *stats.Median != 94.5 {
+		t.Errorf("%+v, want 90 to 99", stats)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	for _, mode := range []string{"running", "lazy"} {
+		b.Run(mode, func(b *testing.B) {
+			tc := setup(b, "LAZY_STATS="+strconv.FormatBool(mode == "lazy"), "WINDOW=1s")
+			handler := newHandler()
+			b.ResetTimer()
+			for range b.N {
+				// A transaction a millisecond keeps about a thousand in the
+				// window.
+				tc.advance(time.Millisecond)
+				r := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(tx("10", tc.time())))
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusCreated {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// RollingMedian tracks the median amount of the transactions in the window
+// incrementally: a max-heap holds the lower half of the amounts and a
+// min-heap the upper half, so the median is read off their tops. Expired
+// transactions are removed lazily, by counting them in pending and dropping
+// them when they reach the top of a heap.
+//
+// Transactions leave in the order their expiry was due when they were added,
+// so after the window shrinks, or when per-transaction TTLs differ, one can
+// linger until those ahead of it have expired too.
+type RollingMedian struct {
+	lock sync.Mutex
+
+	lower, upper           floatHeap // lower holds negated amounts
+	lowerCount, upperCount int
+	pending                map[float64]int
+
+	expiring expiryHeap
+}
+
+func (m *RollingMedian) add(t *Transaction, now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.expire(now)
+
+	ttl := t.ttl
+	if ttl == 0 {
+		ttl = statsWindow()
+	}
+	heap.Push(&m.expiring, expiryEntry{due: t.Timestamp.Add(ttl), t: t})
+
+	if m.lowerCount == 0 || t.Amount <= -m.lower[0] {
+		heap.Push(&m.lower, -t.Amount)
+		m.lowerCount++
+	} else {
+		heap.Push(&m.upper, t.Amount)
+		m.upperCount++
+	}
+	m.rebalance()
+}
+
+// median returns the median amount in the window at now, interpolated by
+// method between the two middle amounts when there is an even number, and
+// reports false if the window is empty. With one transaction it is that
+// transaction's amount.
+func (m *RollingMedian) median(now time.Time, method string) (float64, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.expire(now)
+
+	switch {
+	case m.lowerCount == 0:
+		return 0, false
+	case m.lowerCount > m.upperCount:
+		return -m.lower[0], true
+	}
+
+	switch method {
+	case percentileNearestRank, percentileLower:
+		return -m.lower[0], true
+	case percentileHigher:
+		return m.upper[0], true
+	}
+	return (-m.lower[0] + m.upper[0]) / 2, true
+}
+
+func (m *RollingMedian) reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lower, m.upper = nil, nil
+	m.lowerCount, m.upperCount = 0, 0
+	m.pending = nil
+	m.expiring = nil
+}
+
+func (m *RollingMedian) expire(now time.Time) {
+	for len(m.expiring) > 0 && m.expiring[0].t.expired(now) {
+		m.remove(heap.Pop(&m.expiring).(expiryEntry).t.Amount)
+	}
+}
+
+func (m *RollingMedian) remove(amount float64) {
+	if m.pending == nil {
+		m.pending = make(map[float64]int)
+	}
+	m.pending[amount]++
+
+	if amount <= -m.lower[0] {
+		m.lowerCount--
+		if amount == -m.lower[0] {
+			m.prune(&m.lower, -1)
+		}
+	} else {
+		m.upperCount--
+		if amount == m.upper[0] {
+			m.prune(&m.upper, 1)
+		}
+	}
+	m.rebalance()
+}
+
+// prune pops removed amounts off the top of h, whose values are amounts
+// multiplied by sign.
+func (m *RollingMedian) prune(h *floatHeap, sign float64) {
+	for len(*h) > 0 {
+		amount := (*h)[0] * sign
+		if m.pending[amount] == 0 {
+			return
+		}
+		if m.pending[amount]--; m.pending[amount] == 0 {
+			delete(m.pending, amount)
+		}
+		heap.Pop(h)
+	}
+}
+
+// rebalance keeps the lower half equal in size to the upper half, or one
+// larger.
+func (m *RollingMedian) rebalance() {
+	switch {
+	case m.lowerCount > m.upperCount+1:
+		heap.Push(&m.upper, -heap.Pop(&m.lower).(float64))
+		m.lowerCount--
+		m.upperCount++
+		m.prune(&m.lower, -1)
+	case m.lowerCount < m.upperCount:
+		heap.Push(&m.lower, -heap.Pop(&m.upper).(float64))
+		m.upperCount--
+		m.lowerCount++
+		m.prune(&m.upper, 1)
+	}
+}
+
+type floatHeap []float64
+
+func (h floatHeap) Len() int           { return len(h) }
+func (h floatHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h floatHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *floatHeap) Push(x any)        { *h = append(*h, x.(float64)) }
+func (h *floatHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type expiryEntry struct {
+	due time.Time
+	t   *Transaction
+}
+
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	old[len(old)-1] = expiryEntry{}
+	*h = old[:len(old)-1]
+	return x
+}
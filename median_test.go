@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestRollingMedian(t *testing.T) {
+	setup(t)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	var m RollingMedian
+	var added []*Transaction
+	now := testStart
+	for i := range 3000 {
+		now = now.Add(time.Duration(rng.IntN(2000)) * time.Millisecond)
+		// Few distinct amounts, so duplicates are removed lazily too.
+		tr := &Transaction{Amount: float64(rng.IntN(50)), Timestamp: now.Add(-time.Duration(rng.IntN(59)) * time.Second)}
+		m.add(tr, now)
+		added = append(added, tr)
+
+		var live []*Transaction
+		for _, tr := range added {
+			if !tr.expired(now) {
+				live = append(live, tr)
+			}
+		}
+		sorted := sortedAmounts(live)
+		for _, method := range percentileMethods {
+			got, ok := m.median(now, method)
+			if want := percentile(sorted, 0.5, method); !ok || got != want {
+				t.Fatalf("after %d transactions, %s median %v, sorted %v", i+1, method, got, want)
+			}
+		}
+	}
+
+	if _, ok := m.median(now.Add(2*time.Minute), percentileLinear); ok {
+		t.Error("median reported for an expired window")
+	}
+}
+
+func BenchmarkMedian(b *testing.B) {
+	const size = 100000
+	setup(b, "WINDOW=1h")
+	rng := rand.New(rand.NewPCG(1, 2))
+	txs := make([]*Transaction, size)
+	for i := range txs {
+		txs[i] = &Transaction{Amount: rng.Float64() * 1000, Timestamp: testStart}
+	}
+
+	b.Run("rolling", func(b *testing.B) {
+		var m RollingMedian
+		for _, t := range txs {
+			m.add(t, testStart)
+		}
+		b.ResetTimer()
+		for range b.N {
+			m.median(testStart, percentileLinear)
+		}
+	})
+
+	b.Run("sorted", func(b *testing.B) {
+		for range b.N {
+			percentile(sortedAmounts(txs), 0.5, percentileLinear)
+		}
+	})
+}
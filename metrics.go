@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// futureSkewBuckets are the upper bounds of the future-skew histogram.
+var futureSkewBuckets = []time.Duration{
+	time.Second,
+	time.Second * 5,
+	time.Second * 30,
+	time.Minute,
+	time.Minute * 5,
+	time.Hour,
+}
+
+// IngestionMetrics counts what happened to posted transactions. It is
+// cleared by /reset along with the statistics.
+type IngestionMetrics struct {
+	lock     sync.Mutex
+	accepted int
+	stale    int
+
+	// futureSkew counts rejected future-dated transactions per bucket of
+	// futureSkewBuckets, with a final overflow bucket.
+	futureSkew    []int
+	futureSkewSum time.Duration
+	futureSkewMax time.Duration
+}
+
+var metrics = IngestionMetrics{futureSkew: make([]int, len(futureSkewBuckets)+1)}
+
+func (m *IngestionMetrics) observeAccepted() {
+	m.lock.Lock()
+	m.accepted++
+	m.lock.Unlock()
+}
+
+func (m *IngestionMetrics) observeStale() {
+	m.lock.Lock()
+	m.stale++
+	m.lock.Unlock()
+}
+
+// observeFutureSkew records a transaction rejected for being skew ahead of
+// the server clock.
+func (m *IngestionMetrics) observeFutureSkew(skew time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	i := 0
+	for i < len(futureSkewBuckets) && skew > futureSkewBuckets[i] {
+		i++
+	}
+	m.futureSkew[i]++
+	m.futureSkewSum += skew
+	if skew > m.futureSkewMax {
+		m.futureSkewMax = skew
+	}
+}
+
+func (m *IngestionMetrics) reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.accepted = 0
+	m.stale = 0
+	m.futureSkew = make([]int, len(futureSkewBuckets)+1)
+	m.futureSkewSum = 0
+	m.futureSkewMax = 0
+}
+
+// metricsHandler writes the ingestion metrics in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	statsCache.lock.RLock()
+	cityBuckets, geohashBuckets := len(statsCache.cities), len(statsCache.geohashes)
+	currencyBuckets := len(statsCache.currencies)
+	statsCache.lock.RUnlock()
+
+	fmt.Fprintf(w, "# TYPE stats_buckets gauge\n")
+	fmt.Fprintf(w, "stats_buckets{kind=\"city\"} %d\n", cityBuckets)
+	fmt.Fprintf(w, "stats_buckets{kind=\"geohash\"} %d\n", geohashBuckets)
+	fmt.Fprintf(w, "stats_buckets{kind=\"currency\"} %d\n", currencyBuckets)
+
+	hits, misses := statsCache.cityCache.counts()
+	fmt.Fprintf(w, "# TYPE city_stats_cache_hits_total counter\n")
+	fmt.Fprintf(w, "city_stats_cache_hits_total %d\n", hits)
+	fmt.Fprintf(w, "# TYPE city_stats_cache_misses_total counter\n")
+	fmt.Fprintf(w, "city_stats_cache_misses_total %d\n", misses)
+
+	subscribers, dropped := statsEvents.counts()
+	fmt.Fprintf(w, "# TYPE stats_event_subscribers gauge\n")
+	fmt.Fprintf(w, "stats_event_subscribers %d\n", subscribers)
+	fmt.Fprintf(w, "# TYPE stats_events_dropped_total counter\n")
+	fmt.Fprintf(w, "stats_events_dropped_total %d\n", dropped)
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	fmt.Fprintf(w, "# TYPE transactions_accepted_total counter\n")
+	fmt.Fprintf(w, "transactions_accepted_total %d\n", metrics.accepted)
+	fmt.Fprintf(w, "# TYPE transactions_stale_total counter\n")
+	fmt.Fprintf(w, "transactions_stale_total %d\n", metrics.stale)
+
+	fmt.Fprintf(w, "# TYPE transactions_future_skew_seconds histogram\n")
+	cumulative := 0
+	for i, bound := range futureSkewBuckets {
+		cumulative += metrics.futureSkew[i]
+		fmt.Fprintf(w, "transactions_future_skew_seconds_bucket{le=\"%g\"} %d\n", bound.Seconds(), cumulative)
+	}
+	cumulative += metrics.futureSkew[len(futureSkewBuckets)]
+	fmt.Fprintf(w, "transactions_future_skew_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(w, "transactions_future_skew_seconds_sum %g\n", metrics.futureSkewSum.Seconds())
+	fmt.Fprintf(w, "transactions_future_skew_seconds_count %d\n", cumulative)
+
+	fmt.Fprintf(w, "# TYPE transactions_future_skew_max_seconds gauge\n")
+	fmt.Fprintf(w, "transactions_future_skew_max_seconds %g\n", metrics.futureSkewMax.Seconds())
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gzipMiddleware compresses responses for clients that accept gzip, provided
+// the body reaches config.GzipMinSize and its type is in config.GzipTypes.
+// Responses that already carry a Content-Encoding are passed through.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// decompressMiddleware transparently decompresses request bodies sent with
+// Content-Encoding: gzip, answering 400 when the stream does not start as
+// gzip; corruption further in fails decoding as any malformed body does.
+// Every body, decompressed or not, is capped at config.MaxBodyBytes.
+func decompressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			r.Body = gz
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+		if config.MaxBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, config.MaxBodyBytes)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// the body is large enough to compress.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	if g.decided {
+		return g.ResponseWriter.Write(p)
+	}
+
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= config.GzipMinSize {
+		if err := g.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		g.decide()
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) Close() {
+	if !g.decided && g.status != 0 {
+		g.decide()
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
+
+// decide writes the deferred header, choosing compression if the buffered
+// body qualifies, and then flushes the buffer.
+func (g *gzipResponseWriter) decide() error {
+	g.decided = true
+
+	h := g.Header()
+	if len(g.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+
+	if len(g.buf) >= config.GzipMinSize && h.Get("Content-Encoding") == "" && gzipAllowed(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+		_, err := g.gz.Write(g.buf)
+		g.buf = nil
+		return err
+	}
+
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+func gzipAllowed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+
+	for _, allowed := range config.GzipTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+const (
+	corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS"
+	corsAllowHeaders = "Content-Type, X-API-Key, X-Correlation-ID"
+)
+
+// corsMiddleware adds CORS headers for origins in config.CORSOrigins and
+// answers preflight requests itself.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(config.CORSOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		allowed := ""
+		for _, o := range config.CORSOrigins {
+			if o == origin {
+				allowed = origin
+				break
+			}
+			if o == "*" {
+				allowed = "*"
+			}
+		}
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", allowed)
+		if config.CORSCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+		h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		if config.CORSMaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(config.CORSMaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// timeoutMiddleware answers 503 when a handler runs past its timeout. The
+// handler keeps running to completion in the background, so any locks it
+// holds are still released by its deferred unlocks. The streamingRoutes are
+// passed straight through.
+func timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(streamingRoutes, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d, ok := config.RouteTimeouts[r.URL.Path]
+		if !ok {
+			d = config.WriteTimeout
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				d = config.ReadTimeout
+			}
+		}
+		if d <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.TimeoutHandler(next, d, "Request timed out").ServeHTTP(w, r)
+	})
+}
+
+// serverTimeMiddleware stamps every response with the server's reference
+// time, so clients can spot clock skew behind future or stale rejections.
+func serverTimeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server-Time", clock().Format(time.RFC3339Nano))
+		next.ServeHTTP(w, r)
+	})
+}
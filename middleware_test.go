@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    []string
+		origin string
+		want   map[string]string
+	}{
+		{
+			name:   "credentials",
+			env:    []string{"CORS_ORIGINS=https://app.example.com", "CORS_CREDENTIALS=true", "CORS_MAX_AGE=10m"},
+			origin: "https://app.example.com",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Allow-Methods":     corsAllowMethods,
+			},
+		},
+		{
+			name:   "wildcard",
+			env:    []string{"CORS_ORIGINS=*"},
+			origin: "https://other.example.com",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Max-Age":           "",
+			},
+		},
+		{
+			name:   "unlisted origin",
+			env:    []string{"CORS_ORIGINS=https://app.example.com", "CORS_CREDENTIALS=true"},
+			origin: "https://other.example.com",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			w := request(t, http.MethodOptions, "/transactions", "", "Origin: "+tt.origin, "Access-Control-Request-Method: POST")
+			for name, want := range tt.want {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s: %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSCredentialsWithWildcard(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CORS_CREDENTIALS with a wildcard origin was accepted")
+		}
+	}()
+	setup(t, "CORS_ORIGINS=*", "CORS_CREDENTIALS=true")
+}
+
+func gzipped(t *testing.T, body string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	batch := "[" + tx("10", testStart) + "," + tx("20", testStart) + "]"
+	tests := []struct {
+		name, target, body string
+		want               int
+	}{
+		{"batch", "/transactions/batch", gzipped(t, batch), http.StatusOK},
+		{"transaction", "/transactions", gzipped(t, tx("10", testStart)), http.StatusCreated},
+		{"location", "/location", gzipped(t, `{"city":"bangalore"}`), http.StatusNoContent},
+		{"not gzip", "/transactions", tx("10", testStart), http.StatusBadRequest},
+		{"truncated", "/transactions/batch", gzipped(t, batch)[:30], http.StatusBadRequest},
+		// A kilobyte compressed, a megabyte decompressed.
+		{"bomb", "/transactions/batch", gzipped(t, "["+strings.Repeat(" ", 1<<20)+"]"), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, "MAX_BODY_BYTES=65536")
+			if w := request(t, http.MethodPost, tt.target, tt.body, "Content-Encoding: gzip"); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	t.Run("counted", func(t *testing.T) {
+		setup(t)
+		request(t, http.MethodPost, "/transactions/batch", gzipped(t, batch), "Content-Encoding: gzip")
+		if stats := getStats(t, "/statistics"); stats.Count != 2 || stats.Sum != 30 {
+			t.Errorf("count %d and sum %v, want the two transactions in the batch", stats.Count, stats.Sum)
+		}
+	})
+}
+
+func TestGzipResponse(t *testing.T) {
+	large := strings.Repeat(`{"amount":10}`, 100)
+	tests := []struct {
+		name, contentType, encoding, body string
+		gzipped                           bool
+	}{
+		{"large JSON", "application/json", "", large, true},
+		{"text", "text/plain; charset=utf-8", "", large, true},
+		{"below the minimum", "application/json", "", large[:1023], false},
+		{"disallowed type", "application/x-protobuf", "", large, false},
+		{"already encoded", "application/json", "br", large, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				// Written in pieces, so the decision waits on the
+				// buffer.
+				for chunk := range slices.Chunk([]byte(tt.body), 100) {
+					w.Write(chunk)
+				}
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip, deflate")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			body := w.Body.String()
+			wantEncoding, wantVary := tt.encoding, ""
+			if tt.gzipped {
+				wantEncoding, wantVary = "gzip", "Accept-Encoding"
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decompressed, err := io.ReadAll(gz)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(decompressed)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != wantEncoding {
+				t.Errorf("Content-Encoding %q, want %q", got, wantEncoding)
+			}
+			if got := w.Header().Get("Vary"); got != wantVary {
+				t.Errorf("Vary %q, want %q", got, wantVary)
+			}
+			if body != tt.body {
+				t.Errorf("body of %d bytes, want the %d written", len(body), len(tt.body))
+			}
+		})
+	}
+
+	t.Run("not accepted", func(t *testing.T) {
+		setup(t, "GZIP_MIN_SIZE=1")
+		if w := request(t, http.MethodGet, "/statistics", ""); w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Content-Encoding %q without Accept-Encoding", w.Header().Get("Content-Encoding"))
+		}
+	})
+}
+
+func BenchmarkGzipStats(b *testing.B) {
+	for _, encoding := range []string{"", "gzip"} {
+		b.Run("accept="+encoding, func(b *testing.B) {
+			setup(b, "GZIP_MIN_SIZE=1")
+			post(b, tx("10", testStart), http.StatusCreated)
+			handler := newHandler()
+			b.ResetTimer()
+			for range b.N {
+				r := httptest.NewRequest(http.MethodGet, "/statistics", nil)
+				if encoding != "" {
+					r.Header.Set("Accept-Encoding", encoding)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != encoding {
+					b.Fatalf("status %d and Content-Encoding %q", w.Code, w.Header().Get("Content-Encoding"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+)
+
+const msgpackContentType = "application/msgpack"
+
+func acceptsMsgpack(r *http.Request) bool {
+	return acceptsMediaType(r, msgpackContentType)
+}
+
+// MarshalMsgpack encodes s as a msgpack map with the same keys, and the same
+// omitted fields, as its JSON form.
+func (s Stats) MarshalMsgpack() []byte {
+	var fields []byte
+	n := 0
+	field := func(key string, value []byte) {
+		fields = appendMsgpackString(fields, key)
+		fields = append(fields, value...)
+		n++
+	}
+
+	field("sum", appendMsgpackFloat(nil, s.Sum))
+	field("avg", appendMsgpackFloat(nil, s.Avg))
+	field("max", appendMsgpackFloat(nil, s.Max))
+	field("min", appendMsgpackFloat(nil, s.Min))
+	field("count", appendMsgpackUint(nil, uint64(s.Count)))
+	field("first", appendMsgpackFloat(nil, s.First))
+	field("last", appendMsgpackFloat(nil, s.Last))
+	if s.Sampled {
+		field("sampled", appendMsgpackBool(nil, true))
+	}
+	if s.Warming {
+		field("warming", appendMsgpackBool(nil, true))
+	}
+	if s.DecayedMax != nil {
+		field("decayedMax", appendMsgpackFloat(nil, *s.DecayedMax))
+	}
+	if s.DecayedMin != nil {
+		field("decayedMin", appendMsgpackFloat(nil, *s.DecayedMin))
+	}
+	if s.Median != nil {
+		field("median", appendMsgpackFloat(nil, *s.Median))
+	}
+	if s.P95 != nil {
+		field("p95", appendMsgpackFloat(nil, *s.P95))
+	}
+	if s.WindowSeconds != 0 {
+		field("windowSeconds", appendMsgpackFloat(nil, s.WindowSeconds))
+	}
+	if s.InsufficientData {
+		field("insufficientData", appendMsgpackBool(nil, true))
+	}
+	if c := s.Cardinality; c != nil {
+		b := appendMsgpackMapHeader(nil, 5)
+		for _, kv := range []struct {
+			key   string
+			count int
+		}{{"cities", c.Cities}, {"categories", c.Categories}, {"types", c.Types}, {"currencies", c.Currencies}, {"sources", c.Sources}} {
+			b = appendMsgpackString(b, kv.key)
+			b = appendMsgpackUint(b, uint64(kv.count))
+		}
+		field("cardinality", b)
+	}
+
+	return append(appendMsgpackMapHeader(nil, n), fields...)
+}
+
+// msgpackEmptyMap is the msgpack form of "{}".
+var msgpackEmptyMap = appendMsgpackMapHeader(nil, 0)
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	if n < 16 {
+		return append(b, 0x80|byte(n))
+	}
+	b = append(b, 0xde)
+	return binary.BigEndian.AppendUint16(b, uint16(n))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	if len(s) < 32 {
+		b = append(b, 0xa0|byte(len(s)))
+	} else {
+		b = append(b, 0xd9, byte(len(s)))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	b = append(b, 0xcb)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	if v < 128 {
+		return append(b, byte(v))
+	}
+	b = append(b, 0xcf)
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decodeMsgpack reads one value of the kinds MarshalMsgpack writes and
+// returns it with the bytes that follow it.
+func decodeMsgpack(t *testing.T, b []byte) (any, []byte) {
+	t.Helper()
+	if len(b) == 0 {
+		t.Fatal("unexpected end of msgpack")
+	}
+	switch c := b[0]; {
+	case c < 0x80:
+		return uint64(c), b[1:]
+	case c&0xf0 == 0x80, c == 0xde:
+		n, rest := int(c&0x0f), b[1:]
+		if c == 0xde {
+			n, rest = int(binary.BigEndian.Uint16(rest)), rest[2:]
+		}
+		m := make(map[string]any, n)
+		for range n {
+			var key, value any
+			key, rest = decodeMsgpack(t, rest)
+			value, rest = decodeMsgpack(t, rest)
+			m[key.(string)] = value
+		}
+		return m, rest
+	case c&0xe0 == 0xa0:
+		n := int(c & 0x1f)
+		return string(b[1 : 1+n]), b[1+n:]
+	case c == 0xd9:
+		n := int(b[1])
+		return string(b[2 : 2+n]), b[2+n:]
+	case c == 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), b[9:]
+	case c == 0xcf:
+		return binary.BigEndian.Uint64(b[1:]), b[9:]
+	case c == 0xc2, c == 0xc3:
+		return c == 0xc3, b[1:]
+	}
+	t.Fatalf("unexpected msgpack type %#x", b[0])
+	return nil, nil
+}
+
+func TestMsgpackStats(t *testing.T) {
+	setup(t, "MEDIAN=true", "DECAY_HALF_LIFE=30s")
+	post(t, tx("10", testStart.Add(-30*time.Second)), http.StatusCreated)
+	post(t, tx("-4", testStart), http.StatusCreated)
+	post(t, tx("200", testStart), http.StatusCreated)
+
+	for _, target := range []string{"/statistics", "/statistics?include=cardinality,p95"} {
+		want := getStats(t, target)
+		w := request(t, http.MethodGet, target, "", "Accept: "+msgpackContentType)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != msgpackContentType {
+			t.Fatalf("%s: status %d, content type %q", target, w.Code, w.Header().Get("Content-Type"))
+		}
+
+		value, rest := decodeMsgpack(t, w.Body.Bytes())
+		if len(rest) > 0 {
+			t.Errorf("%s: %d bytes after the map", target, len(rest))
+		}
+		// The map has the JSON keys, so it decodes back into Stats by way
+		// of JSON.
+		b, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Stats
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: msgpack %+v, JSON %+v", target, got, want)
+		}
+	}
+
+	reset(t)
+	w := request(t, http.MethodGet, "/statistics", "", "Accept: "+msgpackContentType)
+	if value, _ := decodeMsgpack(t, w.Body.Bytes()); len(value.(map[string]any)) != 0 {
+		t.Errorf("empty window: %v, want an empty map", value)
+	}
+}
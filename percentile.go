@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Percentile interpolation methods, for config.PercentileMethod. For the
+// p-th percentile of n sorted amounts x[0..n-1], with h = (n-1)*p:
+//
+//	nearest-rank  x[ceil(p*n)-1], the smallest amount with at least p of
+//	              the amounts at or below it
+//	linear        x[floor(h)] + (h-floor(h)) * (x[floor(h)+1] - x[floor(h)])
+//	lower         x[floor(h)]
+//	higher        x[ceil(h)]
+//
+// All of them return the amount itself when there is only one.
+const (
+	percentileNearestRank = "nearest-rank"
+	percentileLinear      = "linear"
+	percentileLower       = "lower"
+	percentileHigher      = "higher"
+)
+
+var percentileMethods = []string{percentileNearestRank, percentileLinear, percentileLower, percentileHigher}
+
+// percentile returns the p-th percentile, for p from 0 to 1, of the sorted
+// amounts, which must not be empty.
+func percentile(sorted []float64, p float64, method string) float64 {
+	n := len(sorted)
+	h := float64(n-1) * p
+	switch method {
+	case percentileNearestRank:
+		return sorted[max(int(math.Ceil(p*float64(n))), 1)-1]
+	case percentileLower:
+		return sorted[int(math.Floor(h))]
+	case percentileHigher:
+		return sorted[int(math.Ceil(h))]
+	}
+
+	lo := int(math.Floor(h))
+	if lo+1 >= n {
+		return sorted[lo]
+	}
+	return sorted[lo] + (h-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// windowP95 returns the 95th percentile amount of the window at now, or nil
+// if it is empty. It sorts a snapshot of the queue, so the statistics lock
+// is held only to copy it, and must not be held by the caller.
+func windowP95(now time.Time) *float64 {
+	amounts := sortedAmounts(statsCache.Snapshot().inWindow(now))
+	if len(amounts) == 0 {
+		return nil
+	}
+	p95 := percentile(amounts, 0.95, config.PercentileMethod)
+	return &p95
+}
+
+// sortedAmounts returns the amounts of txs in ascending order.
+func sortedAmounts(txs []*Transaction) []float64 {
+	amounts := make([]float64, len(txs))
+	for i, t := range txs {
+		amounts[i] = t.Amount
+	}
+	slices.Sort(amounts)
+	return amounts
+}
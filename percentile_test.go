@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestPercentileMethods(t *testing.T) {
+	// The median of 1 to 4 sits at h = 1.5 and the 95th percentile of 1 to
+	// 10 at h = 8.55.
+	tests := []struct {
+		method      string
+		median, p95 float64
+	}{
+		{percentileNearestRank, 2, 10},
+		{percentileLinear, 2.5, 9.55},
+		{percentileLower, 2, 9},
+		{percentileHigher, 3, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			setup(t, "MEDIAN=true", "PERCENTILE_METHOD="+tt.method)
+			for i := 1; i <= 4; i++ {
+				post(t, tx(strconv.Itoa(i), testStart), http.StatusCreated)
+			}
+			if stats := getStats(t, "/statistics"); stats.Median == nil || *stats.Median != tt.median {
+				t.Errorf("median of 1 to 4: %v, want %v", stats.Median, tt.median)
+			}
+
+			for i := 5; i <= 10; i++ {
+				post(t, tx(strconv.Itoa(i), testStart), http.StatusCreated)
+			}
+			if stats := getStats(t, "/statistics?include=p95"); stats.P95 == nil || math.Abs(*stats.P95-tt.p95) > 1e-9 {
+				t.Errorf("p95 of 1 to 10: %v, want %v", stats.P95, tt.p95)
+			}
+		})
+	}
+}
+
+func TestP95Options(t *testing.T) {
+	setup(t, "MEDIAN=true", "CURRENCY_STATS=true")
+	post(t, tx("10", testStart), http.StatusCreated)
+
+	if stats := getStats(t, "/statistics"); stats.P95 != nil {
+		t.Errorf("p95 %v reported without include=p95", *stats.P95)
+	}
+	for _, target := range []string{"/statistics?include=p95&city=*", "/statistics?include=p95&currency=USD", "/statistics?include=p95&source=a"} {
+		if w := request(t, http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// statsFields are the JSON names of the Stats fields ?fields= may select.
+var statsFields = func() []string {
+	var names []string
+	t := reflect.TypeOf(Stats{})
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}()
+
+// projectedFields returns the fields listed in ?fields=, or nil if there is
+// no projection. The second result is false if any of them is unknown.
+func projectedFields(r *http.Request) ([]string, bool) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil, true
+	}
+	fields := strings.Split(raw, ",")
+	for _, field := range fields {
+		if !slices.Contains(statsFields, field) {
+			return nil, false
+		}
+	}
+	return fields, true
+}
+
+// includeOptions are the optional members ?include= may add to /statistics.
+var includeOptions = []string{"cardinality", "p95"}
+
+// includedOptions returns the options listed in ?include=. The second
+// result is false if any of them is unknown.
+func includedOptions(r *http.Request) (map[string]bool, bool) {
+	included := make(map[string]bool)
+	raw := r.URL.Query().Get("include")
+	if raw == "" {
+		return included, true
+	}
+	for _, option := range strings.Split(raw, ",") {
+		if !slices.Contains(includeOptions, option) {
+			return nil, false
+		}
+		included[option] = true
+	}
+	return included, true
+}
+
+// project keeps only the given JSON members of v. A selected field that v
+// omits, such as an unset median, stays absent.
+func project(v any, fields []string) any {
+	body, _ := json.Marshal(v)
+	var members map[string]json.RawMessage
+	json.Unmarshal(body, &members)
+
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := members[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
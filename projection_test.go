@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestFieldProjection(t *testing.T) {
+	tests := []struct {
+		fields string
+		want   []string
+	}{
+		{"sum,count", []string{"count", "sum"}},
+		{"avg", []string{"avg"}},
+		{"sum,sum", []string{"sum"}},
+		{"max,median", []string{"max", "median"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fields, func(t *testing.T) {
+			setup(t, "MEDIAN=true")
+			post(t, tx("10", testStart), http.StatusCreated)
+			post(t, tx("30", testStart), http.StatusCreated)
+
+			w := request(t, http.MethodGet, "/statistics?fields="+tt.fields, "")
+			var members map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &members); err != nil {
+				t.Fatalf("status %d: %v: %s", w.Code, err, w.Body)
+			}
+			var names []string
+			for name := range members {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("members %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	setup(t)
+	for _, fields := range []string{"total", "sum,", "Sum"} {
+		if w := request(t, http.MethodGet, "/statistics?fields="+fields, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("fields=%s: status %d, want %d", fields, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+// Protobuf wire types used by the Stats message.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func acceptsProtobuf(r *http.Request) bool {
+	return acceptsMediaType(r, protobufContentType)
+}
+
+// acceptsMediaType reports whether the Accept header lists mediaType.
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		accepted, _, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(accepted) == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalProto encodes s as the Stats message in proto/stats.proto. As in
+// proto3, fields holding their zero value are omitted.
+func (s Stats) MarshalProto() []byte {
+	var b []byte
+	b = appendProtoDouble(b, 1, s.Sum)
+	b = appendProtoDouble(b, 2, s.Avg)
+	b = appendProtoDouble(b, 3, s.Max)
+	b = appendProtoDouble(b, 4, s.Min)
+	b = appendProtoVarint(b, 5, uint64(s.Count))
+	b = appendProtoDouble(b, 6, s.First)
+	b = appendProtoDouble(b, 7, s.Last)
+	b = appendProtoBool(b, 8, s.Sampled)
+	b = appendProtoBool(b, 9, s.Warming)
+	b = appendProtoBool(b, 10, s.InsufficientData)
+	b = appendProtoOptionalDouble(b, 11, s.DecayedMax)
+	b = appendProtoOptionalDouble(b, 12, s.DecayedMin)
+	b = appendProtoDouble(b, 13, s.WindowSeconds)
+	b = appendProtoOptionalDouble(b, 14, s.Median)
+	b = appendProtoOptionalDouble(b, 15, s.P95)
+	if c := s.Cardinality; c != nil {
+		var m []byte
+		m = appendProtoVarint(m, 1, uint64(c.Cities))
+		m = appendProtoVarint(m, 2, uint64(c.Categories))
+		m = appendProtoVarint(m, 3, uint64(c.Types))
+		m = appendProtoVarint(m, 4, uint64(c.Currencies))
+		m = appendProtoVarint(m, 5, uint64(c.Sources))
+		b = appendProtoMessage(b, 16, m)
+	}
+	return b
+}
+
+// appendProtoMessage encodes an embedded message, which is written whenever
+// it is present, even when empty.
+func appendProtoMessage(b []byte, field int, m []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(m)))
+	return append(b, m...)
+}
+
+func appendProtoDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return appendProtoOptionalDouble(b, field, &v)
+}
+
+// appendProtoOptionalDouble encodes an optional field, which is written
+// whenever it is present, even as zero.
+func appendProtoOptionalDouble(b []byte, field int, v *float64) []byte {
+	if v == nil {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(*v))
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendProtoVarint(b, field, 1)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// decodeProto reads a message into its field values: float64 for doubles,
+// uint64 for varints and []byte for embedded messages.
+func decodeProto(t *testing.T, b []byte) map[int]any {
+	t.Helper()
+	fields := make(map[int]any)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad key at %x", b)
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint in field %d", field)
+			}
+			fields[field], b = v, b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				t.Fatalf("short double in field %d", field)
+			}
+			fields[field], b = math.Float64frombits(binary.LittleEndian.Uint64(b)), b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				t.Fatalf("bad length in field %d", field)
+			}
+			fields[field], b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d in field %d", key&7, field)
+		}
+	}
+	return fields
+}
+
+func TestProtobufStats(t *testing.T) {
+	setup(t, "MEDIAN=true")
+	post(t, tx("10", testStart.Add(-30*time.Second)), http.StatusCreated)
+	post(t, tx("-4", testStart), http.StatusCreated)
+	post(t, tx("0", testStart), http.StatusCreated)
+
+	want := getStats(t, "/statistics?include=cardinality")
+	w := request(t, http.MethodGet, "/statistics?include=cardinality", "", "Accept: "+protobufContentType)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != protobufContentType {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	fields := decodeProto(t, w.Body.Bytes())
+
+	for field, value := range map[int]any{
+		1:  want.Sum,
+		2:  want.Avg,
+		3:  want.Max,
+		4:  want.Min,
+		5:  uint64(want.Count),
+		6:  want.First,
+		13: want.WindowSeconds,
+		14: *want.Median,
+	} {
+		if fields[field] != value {
+			t.Errorf("field %d: %v, want %v", field, fields[field], value)
+		}
+	}
+	// Last is 0, which proto3 omits.
+	if _, ok := fields[7]; ok {
+		t.Errorf("field 7 holds %v, want it omitted", fields[7])
+	}
+
+	cardinality, _ := fields[16].([]byte)
+	if got := decodeProto(t, cardinality); got[5] != uint64(want.Cardinality.Sources) {
+		t.Errorf("cardinality sources %v, want %d", got[5], want.Cardinality.Sources)
+	}
+}
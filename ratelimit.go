@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is a limit of Requests per Per, allowing bursts of up to Requests.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (r Rate) String() string {
+	if r.Requests <= 0 {
+		return ""
+	}
+	return strconv.Itoa(r.Requests) + "/" + r.Per.String()
+}
+
+// Endpoint groups that are rate limited independently of one another.
+const (
+	groupRead  = "read"
+	groupWrite = "write"
+	groupAdmin = "admin"
+)
+
+// endpointGroup puts /admin/ requests in the admin group and other requests
+// in the read or write group by method.
+func endpointGroup(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		return groupAdmin
+	case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		return groupRead
+	}
+	return groupWrite
+}
+
+func groupRate(group string) Rate {
+	switch group {
+	case groupRead:
+		return config.ReadRateLimit
+	case groupWrite:
+		return config.WriteRateLimit
+	}
+	return config.AdminRateLimit
+}
+
+// tokenBucket holds up to Rate.Requests tokens, refilled continuously.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter keeps a token bucket per client and endpoint group.
+type RateLimiter struct {
+	lock    sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+var rateLimiter RateLimiter
+
+// maxRateBuckets is how many buckets the limiter holds before it prunes
+// those that have refilled, and so carry no state worth keeping.
+const maxRateBuckets = 4096
+
+// take spends a token from the bucket for key, returning how long until one
+// is available if there is none.
+func (l *RateLimiter) take(key string, rate Rate, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	perToken := float64(rate.Per) / float64(rate.Requests)
+	refill := func(b *tokenBucket) {
+		b.tokens = min(float64(rate.Requests), b.tokens+float64(now.Sub(b.updated))/perToken)
+		b.updated = now
+	}
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.prune(now)
+		}
+		bucket = &tokenBucket{tokens: float64(rate.Requests), updated: now}
+		l.buckets[key] = bucket
+	}
+	refill(bucket)
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) * perToken)
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+func (l *RateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		group, _, _ := strings.Cut(key, " ")
+		rate := groupRate(group)
+		if rate.Requests <= 0 || bucket.tokens+float64(now.Sub(bucket.updated))*float64(rate.Requests)/float64(rate.Per) >= float64(rate.Requests) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitMiddleware answers 429 to clients over the limit of the request's
+// endpoint group, with a Retry-After for that group.
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := endpointGroup(r)
+		rate := groupRate(group)
+		if rate.Requests <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, wait := rateLimiter.take(group+" "+clientIP(r), rate, clock())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many "+group+" requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
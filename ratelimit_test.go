@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitGroups(t *testing.T) {
+	tc := setup(t, "READ_RATE_LIMIT=3/1m", "WRITE_RATE_LIMIT=1/10s")
+
+	type step struct {
+		method, target string
+		want           int
+		retryAfter     string
+	}
+	check := func(steps ...step) {
+		t.Helper()
+		for _, s := range steps {
+			body := ""
+			if s.method == http.MethodPost {
+				body = tx("10", tc.time())
+			}
+			w := request(t, s.method, s.target, body)
+			if w.Code != s.want || w.Header().Get("Retry-After") != s.retryAfter {
+				t.Errorf("%s %s: status %d, Retry-After %q, want %d and %q", s.method, s.target, w.Code, w.Header().Get("Retry-After"), s.want, s.retryAfter)
+			}
+		}
+	}
+
+	check(
+		step{http.MethodPost, "/transactions", http.StatusCreated, ""},
+		step{http.MethodPost, "/transactions", http.StatusTooManyRequests, "10"},
+		step{http.MethodDelete, "/reset", http.StatusTooManyRequests, "10"},
+		// Reads have their own bucket.
+		step{http.MethodGet, "/statistics", http.StatusOK, ""},
+		step{http.MethodGet, "/statistics", http.StatusOK, ""},
+		step{http.MethodGet, "/statistics", http.StatusOK, ""},
+		step{http.MethodGet, "/statistics", http.StatusTooManyRequests, "20"},
+	)
+
+	tc.advance(10 * time.Second)
+	check(
+		step{http.MethodPost, "/transactions", http.StatusCreated, ""},
+		step{http.MethodGet, "/statistics", http.StatusTooManyRequests, "10"},
+	)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ResetPreview is returned by DELETE /reset?dryRun=true. Passing Token back
+// as ?token= before ExpiresAt performs the reset.
+type ResetPreview struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Count     int       `json:"count"`
+	Sum       float64   `json:"sum"`
+	Queued    int       `json:"queued"`
+}
+
+// ResetTokens holds the outstanding single-use reset confirmation tokens.
+type ResetTokens struct {
+	lock   sync.Mutex
+	tokens map[string]time.Time
+}
+
+var resetTokens ResetTokens
+
+func (t *ResetTokens) issue(now time.Time) (string, time.Time) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	expiresAt := now.Add(config.ResetTokenTTL)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.tokens == nil {
+		t.tokens = make(map[string]time.Time)
+	}
+	for k, exp := range t.tokens {
+		if now.After(exp) {
+			delete(t.tokens, k)
+		}
+	}
+	t.tokens[token] = expiresAt
+	return token, expiresAt
+}
+
+// redeem consumes token, reporting whether it was outstanding and unexpired.
+func (t *ResetTokens) redeem(token string, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	expiresAt, ok := t.tokens[token]
+	delete(t.tokens, token)
+	return ok && !now.After(expiresAt)
+}
+
+// previewReset describes what a reset would clear and issues a token that
+// confirms it.
+func previewReset(w http.ResponseWriter) {
+	now := clock()
+	token, expiresAt := resetTokens.issue(now)
+
+	statsCache.lock.RLock()
+	current := statsCache.current(now)
+	preview := ResetPreview{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		Count:     current.Count,
+		Sum:       current.Sum,
+		Queued:    len(statsCache.queue),
+	}
+	statsCache.lock.RUnlock()
+
+	json.NewEncoder(w).Encode(preview)
+}
+
+// resetConflict tells a writer that its transaction overlapped a reset and
+// should be sent again.
+func resetConflict(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "A reset is in progress, retry the request", http.StatusConflict)
+}
+
+// ResetFlight coalesces unconditional resets. One that arrives while
+// another is waiting for the lock or running joins it rather than clearing
+// again, so simultaneous resets advance the generation once.
+type ResetFlight struct {
+	lock    sync.Mutex
+	done    chan struct{}
+	cleared Stats
+}
+
+var resetFlight ResetFlight
+
+// reset resets statsCache, or waits for the reset already in flight. It
+// returns the statistics that reset cleared.
+func (f *ResetFlight) reset() Stats {
+	f.lock.Lock()
+	if done := f.done; done != nil {
+		f.lock.Unlock()
+		<-done
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		return f.cleared
+	}
+	done := make(chan struct{})
+	f.done = done
+	f.lock.Unlock()
+
+	statsCache.lock.Lock()
+	cleared := statsCache.current(clock())
+	statsCache.reset()
+	statsCache.lock.Unlock()
+
+	f.lock.Lock()
+	f.done = nil
+	f.cleared = cleared
+	f.lock.Unlock()
+	close(done)
+	return cleared
+}
+
+// rollover starts a new tumbling interval by clearing the running
+// statistics, all of which belong to earlier intervals. Unlike reset it
+// keeps the queue and the generation, so the queue-derived endpoints still
+// see retained transactions. The caller must hold the write lock.
+func (c *StatsCache) rollover() {
+	c.sumOffset -= c.stats.Sum
+	c.stats = Stats{}
+	c.cities = nil
+	c.geohashes = nil
+	c.currencies = nil
+	c.median.reset()
+	c.cityCache.clear()
+}
+
+// reset clears all statistics and starts a new generation. The caller must
+// hold the write lock.
+func (c *StatsCache) reset() {
+	c.stats = Stats{}
+	c.lastUpdated = time.Time{}
+	c.queue = nil
+	c.cities = nil
+	c.geohashes = nil
+	c.currencies = nil
+	c.offered = 0
+	c.ttlQueue = nil
+	c.median.reset()
+	c.cityCache.clear()
+	c.sumOffset = 0
+	c.processed = 0
+	c.resetAt = clock()
+	c.generation.Add(1)
+	metrics.reset()
+	statsEvents.publish(StatsEvent{Type: "reset", Time: c.resetAt})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reset sends DELETE /reset and checks that it cleared the statistics. It
+// may be called from any goroutine.
+func reset(t testing.TB) {
+	t.Helper()
+	if w := request(t, http.MethodDelete, "/reset", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE /reset: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	tc := setup(t, "WARM_UP=10s")
+	post(t, tx("10", testStart), http.StatusCreated)
+	reset(t)
+	post(t, tx("20", testStart), http.StatusCreated)
+
+	if stats := getStats(t, "/statistics"); !stats.Warming || stats.Count != 0 {
+		t.Errorf("during the warm-up: %+v, want only warming", stats)
+	}
+
+	tc.advance(10 * time.Second)
+	if stats := getStats(t, "/statistics"); stats.Warming || stats.Count != 1 || stats.Sum != 20 {
+		t.Errorf("after the warm-up: %+v, want the one transaction since the reset", stats)
+	}
+}
+
+func TestResetDuringWrites(t *testing.T) {
+	setup(t)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				body := tx(strconv.Itoa(i*100+j+1), testStart)
+				if w := request(t, http.MethodPost, "/transactions", body); w.Code != http.StatusCreated && w.Code != http.StatusConflict {
+					t.Errorf("POST /transactions: status %d: %s", w.Code, w.Body)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			reset(t)
+		}
+	}()
+	wg.Wait()
+
+	// Whatever survived the last reset is counted exactly once.
+	statsCache.lock.RLock()
+	stats := statsCache.current(testStart)
+	queued := aggregate(statsCache.filter(testStart, func(*Transaction) bool { return true }))
+	statsCache.lock.RUnlock()
+	if stats.Count != queued.Count || stats.Sum != queued.Sum {
+		t.Errorf("running count %d and sum %v, queued %d and %v", stats.Count, stats.Sum, queued.Count, queued.Sum)
+	}
+
+	reset(t)
+	post(t, tx("5", testStart), http.StatusCreated)
+	post(t, tx("7", testStart), http.StatusCreated)
+	if stats := getStats(t, "/statistics"); stats.Count != 2 || stats.Sum != 12 {
+		t.Errorf("after the last reset: %+v, want 2 transactions summing to 12", stats)
+	}
+}
+
+func TestWriteDuringReset(t *testing.T) {
+	setup(t)
+	post(t, tx("10", testStart), http.StatusCreated)
+
+	// Holding the lock keeps the reset in progress.
+	statsCache.lock.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reset(t)
+	}()
+	for statsCache.resetting.Load() == 0 {
+		runtime.Gosched()
+	}
+
+	w := request(t, http.MethodPost, "/transactions", tx("20", testStart))
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("during the reset: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	statsCache.lock.Unlock()
+	<-done
+
+	post(t, tx("30", testStart), http.StatusCreated)
+	if stats := getStats(t, "/statistics"); stats.Count != 1 || stats.Sum != 30 {
+		t.Errorf("after the reset: %+v, want only the retried transaction", stats)
+	}
+}
+
+func TestConditionalReset(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+		count int
+	}{
+		{"?ifCountAtLeast=3", http.StatusPreconditionFailed, 2},
+		{"?ifCountAtLeast=2", http.StatusNoContent, 0},
+		{"?ifCountAtLeast=0", http.StatusNoContent, 0},
+		{"?ifCountAtLeast=-1", http.StatusBadRequest, 2},
+		{"?ifCountAtLeast=many", http.StatusBadRequest, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setup(t)
+			post(t, tx("10", testStart), http.StatusCreated)
+			post(t, tx("20", testStart), http.StatusCreated)
+			if w := request(t, http.MethodDelete, "/reset"+tt.query, ""); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if stats := getStats(t, "/statistics"); stats.Count != tt.count {
+				t.Errorf("count %d, want %d", stats.Count, tt.count)
+			}
+		})
+	}
+}
+
+func TestConcurrentResets(t *testing.T) {
+	setup(t)
+	post(t, tx("10", testStart), http.StatusCreated)
+	before := statsCache.generation.Load()
+
+	// Holding the lock keeps the first reset running until all have
+	// arrived.
+	const resets = 16
+	statsCache.lock.Lock()
+	var wg sync.WaitGroup
+	for range resets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reset(t)
+		}()
+	}
+	for statsCache.resetting.Load() < resets {
+		runtime.Gosched()
+	}
+	// A reset counts as arriving just before it joins the one in flight.
+	time.Sleep(10 * time.Millisecond)
+	statsCache.lock.Unlock()
+	wg.Wait()
+
+	if after := statsCache.generation.Load(); after != before+1 {
+		t.Errorf("generation advanced by %d, want 1", after-before)
+	}
+	if stats := getStats(t, "/statistics"); stats.Count != 0 {
+		t.Errorf("count %d after the resets, want 0", stats.Count)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRollups is the most windows one /statistics/rollups request may ask for.
+const maxRollups = 1000
+
+// rollupsHandler reports the statistics of each of the last ?count= windows
+// of ?size=, oldest first, from the queued transactions. Together they must
+// fit within the retention period, and there may be at most maxRollups of
+// them. Windows without transactions come back as zeros.
+func rollupsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	size, err := time.ParseDuration(query.Get("size"))
+	if err != nil || size <= 0 {
+		http.Error(w, "Invalid size", http.StatusBadRequest)
+		return
+	}
+	count, err := strconv.Atoi(query.Get("count"))
+	if err != nil || count <= 0 {
+		http.Error(w, "Invalid count", http.StatusBadRequest)
+		return
+	}
+	if count > maxRollups {
+		http.Error(w, "Count must be between 1 and "+strconv.Itoa(maxRollups), http.StatusBadRequest)
+		return
+	}
+	// Dividing rather than multiplying keeps a huge count from overflowing.
+	if count > int(retention()/size) {
+		http.Error(w, "size times count must be within the retention period", http.StatusBadRequest)
+		return
+	}
+
+	flushWrites()
+
+	now := clock()
+	start := now.Add(-size * time.Duration(count))
+	rollups := make([]Stats, count)
+
+	for _, t := range statsCache.Snapshot().Queue {
+		if t.Timestamp.Before(start) || t.Timestamp.After(now) {
+			continue
+		}
+		i := int(t.Timestamp.Sub(start) / size)
+		if i == len(rollups) {
+			i--
+		}
+		rollups[i].add(t)
+	}
+
+	streamJSONArray(w, len(rollups), func(i int) any {
+		rollups[i].derive()
+		return rollups[i]
+	})
+}
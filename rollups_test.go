@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRollups(t *testing.T) {
+	tc := setup(t, "RETENTION=5m")
+	post(t, tx("10", testStart), http.StatusCreated)
+	tc.advance(4 * time.Minute)
+	post(t, tx("20", tc.time()), http.StatusCreated)
+	post(t, tx("40", tc.time()), http.StatusCreated)
+
+	w := request(t, http.MethodGet, "/statistics/rollups?size=1m&count=5", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var rollups []Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &rollups); err != nil {
+		t.Fatal(err)
+	}
+
+	// Oldest first, from 09:59 to 10:04, a transaction stamped now falling
+	// in the last.
+	want := []Stats{
+		{},
+		{Sum: 10, Avg: 10, Max: 10, Min: 10, Count: 1},
+		{},
+		{},
+		{Sum: 60, Avg: 30, Max: 40, Min: 20, Count: 2},
+	}
+	if len(rollups) != len(want) {
+		t.Fatalf("%d rollups, want %d", len(rollups), len(want))
+	}
+	for i, got := range rollups {
+		if got.Sum != want[i].Sum || got.Avg != want[i].Avg || got.Max != want[i].Max || got.Min != want[i].Min || got.Count != want[i].Count {
+			t.Errorf("rollup %d: %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestRollupsParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"size=1m&count=5", http.StatusOK},
+		{"size=1m&count=6", http.StatusBadRequest},
+		{"size=6m&count=1", http.StatusBadRequest},
+		{"size=300ms&count=1000", http.StatusOK},
+		{"size=1ms&count=1001", http.StatusBadRequest},
+		{"size=1ns&count=9223372036854775807", http.StatusBadRequest},
+		{"size=1m&count=0", http.StatusBadRequest},
+		{"size=1m", http.StatusBadRequest},
+		{"size=0s&count=1", http.StatusBadRequest},
+		{"count=1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setup(t, "RETENTION=5m")
+			if w := request(t, http.MethodGet, "/statistics/rollups?"+tt.query, ""); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// ResetScheduler resets the statistics every config.ResetEvery, on the
+// boundaries nextReset picks.
+type ResetScheduler struct {
+	quit chan struct{}
+	done chan struct{}
+}
+
+var resetScheduler ResetScheduler
+
+func (s *ResetScheduler) start(every time.Duration) {
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		for {
+			timer := time.NewTimer(nextReset(clock(), every).Sub(clock()))
+			select {
+			case <-s.quit:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			scheduledReset()
+		}
+	}()
+}
+
+// stop waits for a scheduled reset in progress to finish and prevents any
+// more. It does nothing if the scheduler was never started.
+func (s *ResetScheduler) stop() {
+	if s.quit == nil {
+		return
+	}
+	close(s.quit)
+	<-s.done
+}
+
+const day = 24 * time.Hour
+
+// nextReset returns the first multiple of every since midnight UTC after now,
+// or the next midnight if that comes first, so 7h resets at 07:00, 14:00,
+// 21:00 and midnight.
+func nextReset(now time.Time, every time.Duration) time.Time {
+	next := truncateInDay(now, every).Add(every)
+	if midnight := now.Truncate(day).Add(day); every < day && next.After(midnight) {
+		return midnight
+	}
+	return next
+}
+
+// truncateInDay rounds t down to a multiple of d since midnight UTC. Unlike
+// t.Truncate(d), which counts from the zero time, it holds for any d that does
+// not divide a day. A d of a day or more is counted from the zero time, which
+// still lands on midnights when d is whole days.
+func truncateInDay(t time.Time, d time.Duration) time.Time {
+	if d >= day {
+		return t.Truncate(d)
+	}
+	midnight := t.Truncate(day)
+	return midnight.Add(t.Sub(midnight).Truncate(d))
+}
+
+// scheduledReset does what an unconditional DELETE /reset does, logging the
+// statistics it clears when config.ResetLogStats is set.
+func scheduledReset() {
+	flushWrites()
+
+	statsCache.resetting.Add(1)
+	defer statsCache.resetting.Add(-1)
+
+	cleared := resetFlight.reset()
+	if config.ResetLogStats {
+		cleared.derive()
+		final, _ := json.Marshal(cleared)
+		log.Printf("scheduled reset: cleared %s", final)
+	}
+}
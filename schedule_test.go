@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNextReset(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, time.March, 2, hour, min, 0, 0, time.UTC)
+	}
+	midnight := at(24, 0)
+	tests := []struct {
+		now   time.Time
+		every time.Duration
+		want  time.Time
+	}{
+		{at(10, 30), time.Hour, at(11, 0)},
+		{at(11, 0), time.Hour, at(12, 0)},
+		{at(6, 59), 7 * time.Hour, at(7, 0)},
+		{at(13, 0), 7 * time.Hour, at(14, 0)},
+		{at(22, 0), 7 * time.Hour, midnight},
+		{at(23, 0), 90 * time.Minute, midnight},
+		{at(10, 0), day, midnight},
+	}
+	for _, tt := range tests {
+		if got := nextReset(tt.now, tt.every); !got.Equal(tt.want) {
+			t.Errorf("nextReset(%v, %v) = %v, want %v", tt.now.Format(time.TimeOnly), tt.every, got, tt.want)
+		}
+	}
+}
+
+func TestScheduledReset(t *testing.T) {
+	tc := setup(t, "RESET_EVERY=1h")
+	post(t, tx("10", testStart), http.StatusCreated)
+	before := statsCache.generation.Load()
+
+	// The next boundary, 11:00, is 50ms away.
+	tc.advance(time.Hour - 50*time.Millisecond)
+	resetScheduler.start(config.ResetEvery)
+	deadline := time.Now().Add(5 * time.Second)
+	for statsCache.generation.Load() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduled reset did not fire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	tc.advance(time.Minute)
+	resetScheduler.stop()
+
+	if stats := getStats(t, "/statistics"); stats.Count != 0 {
+		t.Errorf("count %d after the scheduled reset, want 0", stats.Count)
+	}
+}
+
+func TestTruncateInDay(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, time.March, 2, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		t    time.Time
+		d    time.Duration
+		want time.Time
+	}{
+		{at(10, 0), time.Minute, at(10, 0)},
+		{at(10, 0), 7 * time.Minute, at(9, 55)},
+		{at(10, 1), 7 * time.Minute, at(9, 55)},
+		{at(10, 2), 7 * time.Minute, at(10, 2)},
+		{at(0, 6), 7 * time.Minute, at(0, 0)},
+		{at(23, 59), 7 * time.Hour, at(21, 0)},
+		{at(10, 0), day, at(0, 0)},
+	}
+	for _, tt := range tests {
+		if got := truncateInDay(tt.t, tt.d); !got.Equal(tt.want) {
+			t.Errorf("truncateInDay(%v, %v) = %v, want %v", tt.t.Format(time.TimeOnly), tt.d, got.Format(time.TimeOnly), tt.want.Format(time.TimeOnly))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Transaction payloads may carry a "schemaVersion". The supported versions
+// are:
+//
+//	1  amount and timestamp only
+//	2  adds type, category, currency, metadata, weight and ttl
+//
+// A payload without a version is taken to be the current one. Older
+// payloads are upgraded one version at a time by schemaMigrations before
+// the transaction is validated.
+const currentSchemaVersion = 2
+
+// schemaMigrations[v] upgrades a version v transaction to version v+1.
+var schemaMigrations = map[int]func(*Transaction){
+	1: migrateV1,
+}
+
+// errSchemaVersion rejects a schemaVersion this server does not know.
+var errSchemaVersion = errors.New("Transaction schemaVersion is not supported")
+
+// migrate upgrades t to currentSchemaVersion.
+func (t *Transaction) migrate() error {
+	if t.SchemaVersion == 0 {
+		t.SchemaVersion = currentSchemaVersion
+	}
+	if t.SchemaVersion < 1 || t.SchemaVersion > currentSchemaVersion {
+		return fmt.Errorf("%w: %d", errSchemaVersion, t.SchemaVersion)
+	}
+	for t.SchemaVersion < currentSchemaVersion {
+		schemaMigrations[t.SchemaVersion](t)
+		t.SchemaVersion++
+	}
+	return nil
+}
+
+// migrateV1 drops the fields version 1 did not have, so that a version 1
+// payload is read the way a version 1 server would have read it.
+func migrateV1(t *Transaction) {
+	t.Type = ""
+	t.Category = ""
+	t.Currency = ""
+	t.Metadata = nil
+	t.Weight = nil
+	t.ttl = 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = time.Second * 10
+
+// serve runs handler on the configured TCP address and Unix socket until the
+// process receives SIGINT or SIGTERM, then shuts down gracefully.
+func serve(handler http.Handler) error {
+	server := newServer(handler)
+
+	var serves []func() error
+	if config.Addr != "" {
+		l, err := net.Listen("tcp", config.Addr)
+		if err != nil {
+			return err
+		}
+		serves = append(serves, func() error {
+			if config.TLSCertFile != "" {
+				return server.ServeTLS(l, config.TLSCertFile, config.TLSKeyFile)
+			}
+			return server.Serve(l)
+		})
+	}
+	if config.UnixSocket != "" {
+		l, err := listenUnix(config.UnixSocket)
+		if err != nil {
+			return err
+		}
+		serves = append(serves, func() error { return server.Serve(l) })
+	}
+	if len(serves) == 0 {
+		return errors.New("no listen address configured")
+	}
+
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
+		go func() {
+			errs <- serve()
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-errs:
+		server.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// The queued transactions are applied even when the shutdown times out
+	// with handlers still running, which can no longer queue any.
+	err := server.Shutdown(ctx)
+	workerPool.stop()
+	resetScheduler.stop()
+	return err
+}
+
+// newServer configures the protocols, keep-alives and TLS policy of the
+// server for handler. HTTP/2 over TLS is always offered; config.H2C adds it
+// in clear.
+func newServer(handler http.Handler) *http.Server {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(config.H2C)
+
+	server := &http.Server{
+		Handler:     handler,
+		Protocols:   &protocols,
+		HTTP2:       &http.HTTP2Config{MaxConcurrentStreams: config.HTTP2MaxStreams},
+		IdleTimeout: config.IdleTimeout,
+		TLSConfig: &tls.Config{
+			MinVersion:   config.TLSMinVersion,
+			CipherSuites: config.TLSCipherSuites,
+		},
+	}
+	server.SetKeepAlivesEnabled(config.KeepAlives)
+	return server
+}
+
+// listenUnix listens on a Unix socket at path, replacing a stale socket left
+// by an unclean exit. The socket file is removed when the listener closes.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnixSocket(t *testing.T) {
+	setup(t)
+	path := filepath.Join(t.TempDir(), "api.sock")
+
+	// A socket left behind by an unclean exit is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(newHandler())
+	go server.Serve(l)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Post("http://unix/transactions", "application/json", strings.NewReader(tx("10", testStart)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	if count := statsCache.current(testStart).Count; count != 1 {
+		t.Errorf("count %d, want 1", count)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file left after shutdown: %v", err)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	t.Run("h2c", func(t *testing.T) {
+		setup(t, "H2C=true")
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := newServer(newHandler())
+		go server.Serve(l)
+		defer server.Close()
+
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+		checkHTTP2Statistics(t, client, "http://"+l.Addr().String())
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		certFile, keyFile, pool := testCertificate(t)
+		setup(t, "TLS_CERT_FILE="+certFile, "TLS_KEY_FILE="+keyFile)
+		addr := serveTLS(t)
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			ForceAttemptHTTP2: true,
+		}}
+		checkHTTP2Statistics(t, client, "https://"+addr)
+	})
+}
+
+// testCertificate writes a self-signed certificate for 127.0.0.1 and its key
+// to files, returning their paths and a pool trusting the certificate.
+func testCertificate(t *testing.T) (string, string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+// serveTLS serves the API over TLS as serve does, returning the address.
+func serveTLS(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(newHandler())
+	go server.ServeTLS(l, config.TLSCertFile, config.TLSKeyFile)
+	t.Cleanup(func() { server.Close() })
+	return l.Addr().String()
+}
+
+func checkHTTP2Statistics(t *testing.T, client *http.Client, url string) {
+	t.Helper()
+	resp, err := client.Get(url + "/statistics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("status %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+	}
+}
+
+func TestServerTuning(t *testing.T) {
+	tests := []struct {
+		env     []string
+		streams int
+		idle    time.Duration
+	}{
+		{nil, 250, 2 * time.Minute},
+		{[]string{"HTTP2_MAX_STREAMS=50", "IDLE_TIMEOUT=30s"}, 50, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		setup(t, tt.env...)
+		server := newServer(nil)
+		if server.HTTP2.MaxConcurrentStreams != tt.streams || server.IdleTimeout != tt.idle {
+			t.Errorf("%v: %d streams and idle timeout %v, want %d and %v", tt.env, server.HTTP2.MaxConcurrentStreams, server.IdleTimeout, tt.streams, tt.idle)
+		}
+	}
+}
+
+func TestTLSPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    []string
+		client *tls.Config
+		ok     bool
+	}{
+		{"TLS 1.0", nil, &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS10}, false},
+		{"TLS 1.1", nil, &tls.Config{MinVersion: tls.VersionTLS11, MaxVersion: tls.VersionTLS11}, false},
+		{"TLS 1.2", nil, &tls.Config{MaxVersion: tls.VersionTLS12}, true},
+		{"TLS 1.3", nil, &tls.Config{MinVersion: tls.VersionTLS13}, true},
+		{"TLS 1.2 below the minimum", []string{"TLS_MIN_VERSION=1.3"}, &tls.Config{MaxVersion: tls.VersionTLS12}, false},
+		{"allowed suite", []string{"TLS_CIPHER_SUITES=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}}, true},
+		{"other suite", []string{"TLS_CIPHER_SUITES=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, keyFile, pool := testCertificate(t)
+			setup(t, append(tt.env, "TLS_CERT_FILE="+certFile, "TLS_KEY_FILE="+keyFile)...)
+			addr := serveTLS(t)
+
+			client := tt.client.Clone()
+			client.RootCAs = pool
+			conn, err := tls.Dial("tcp", addr, client)
+			if err == nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("handshake error %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestInsecureTLSConfig(t *testing.T) {
+	for _, env := range []string{"TLS_MIN_VERSION=1.0", "TLS_MIN_VERSION=1.1", "TLS_CIPHER_SUITES=TLS_RSA_WITH_RC4_128_SHA"} {
+		t.Run(env, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s was accepted", env)
+				}
+			}()
+			setup(t, env)
+		})
+	}
+}
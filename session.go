@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const sessionCookie = "location"
+
+var (
+	errNoSession  = errors.New("no location session")
+	errBadSession = errors.New("invalid location session")
+)
+
+// signCity returns a cookie value carrying city and an HMAC-SHA256 of it
+// keyed by config.CookieSecret.
+func signCity(city string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(city))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(citySignature(payload))
+}
+
+func citySignature(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.CookieSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// sessionCity returns the city from the request's signed location cookie.
+// It returns errNoSession when there is no cookie or sessions are disabled,
+// and errBadSession when the cookie has been tampered with.
+func sessionCity(r *http.Request) (string, error) {
+	if config.CookieSecret == "" {
+		return "", errNoSession
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", errNoSession
+	}
+
+	payload, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", errBadSession
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, citySignature(payload)) {
+		return "", errBadSession
+	}
+	city, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errBadSession
+	}
+	return string(city), nil
+}
+
+// sessionHandler sets a signed location cookie so that a browser client is
+// authorised per session rather than by the shared server-side location.
+func sessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if config.CookieSecret == "" {
+		http.Error(w, "Location sessions are disabled", http.StatusForbidden)
+		return
+	}
+
+	var loc Location
+	if !decodeJSON(w, r, &loc) {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    signCity(normalizeCity(loc.City)),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// session posts city to /location/session and returns the cookie value set.
+func session(t *testing.T, city string) string {
+	t.Helper()
+	w := request(t, http.MethodPost, "/location/session", `{"city":"`+city+`"}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("POST /location/session: status %d: %s", w.Code, w.Body)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			return cookie.Value
+		}
+	}
+	t.Fatal("POST /location/session set no cookie")
+	return ""
+}
+
+func TestSession(t *testing.T) {
+	setup(t, "COOKIE_SECRET=secret")
+	bangalore, mysore := session(t, "bangalore"), session(t, "mysore")
+
+	// A cookie signed elsewhere, one carrying another city's signature and
+	// one that is not signed at all.
+	config.CookieSecret = "other"
+	resigned := signCity("bangalore")
+	config.CookieSecret = "secret"
+	_, mysoreSignature, _ := strings.Cut(mysore, ".")
+	swapped := base64.RawURLEncoding.EncodeToString([]byte("bangalore")) + "." + mysoreSignature
+
+	tests := []struct {
+		name, global, cookie string
+		want                 int
+	}{
+		{"authorized session", "mysore", bangalore, http.StatusOK},
+		{"unauthorized session", "bangalore", mysore, http.StatusUnauthorized},
+		{"re-signed", "bangalore", resigned, http.StatusUnauthorized},
+		{"swapped city", "bangalore", swapped, http.StatusUnauthorized},
+		{"unsigned", "bangalore", base64.RawURLEncoding.EncodeToString([]byte("bangalore")), http.StatusUnauthorized},
+		{"bad signature encoding", "bangalore", "YmFuZ2Fsb3Jl.!!", http.StatusUnauthorized},
+		{"no cookie, authorized location", "bangalore", "", http.StatusOK},
+		{"no cookie, unauthorized location", "mysore", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCity(t, tt.global)
+			var headers []string
+			if tt.cookie != "" {
+				headers = append(headers, "Cookie: "+sessionCookie+"="+tt.cookie)
+			}
+			if w := request(t, http.MethodGet, "/statistics", "", headers...); w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionsDisabled(t *testing.T) {
+	setup(t)
+	config.CookieSecret = "secret"
+	mysore := signCity("mysore")
+	config.CookieSecret = ""
+
+	// Without a secret the cookie is ignored for the global location.
+	if w := request(t, http.MethodPost, "/location/session", `{"city":"bangalore"}`); w.Code != http.StatusForbidden {
+		t.Errorf("POST /location/session: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	setCity(t, "bangalore")
+	if w := request(t, http.MethodGet, "/statistics", "", "Cookie: "+sessionCookie+"="+mysore); w.Code != http.StatusOK {
+		t.Errorf("GET /statistics: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// PersistedState is what config.StateFile holds. Only the active location
+// is persisted; transactions are kept in memory alone.
+type PersistedState struct {
+	Location Location `json:"location"`
+}
+
+// loadState restores the location from config.StateFile, if one is
+// configured and exists.
+func loadState() error {
+	if config.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(config.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state PersistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	locationCache.lock.Lock()
+	locationCache.location = state.Location
+	locationCache.lock.Unlock()
+	return nil
+}
+
+// saveLocation writes loc to config.StateFile, replacing the file by rename
+// so that a crash mid-write cannot leave it truncated. The caller must hold
+// the location lock, so that saves land in the order of the changes. The
+// change itself stands even if it cannot be saved.
+func saveLocation(loc Location) {
+	if config.StateFile == "" {
+		return
+	}
+	if err := writeState(PersistedState{Location: loc}); err != nil {
+		log.Printf("state: saving location: %v", err)
+	}
+}
+
+func writeState(state PersistedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(config.StateFile), ".state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), config.StateFile)
+}
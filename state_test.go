@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateRestoresLocation(t *testing.T) {
+	stateFile := "STATE_FILE=" + filepath.Join(t.TempDir(), "state.json")
+	setup(t, stateFile)
+	if err := loadState(); err != nil {
+		t.Fatalf("loading a missing state file: %v", err)
+	}
+	if w := request(t, http.MethodPost, "/location", `{"city":"bangalore","lat":12.97,"lng":77.59}`); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /location: status %d: %s", w.Code, w.Body)
+	}
+
+	// A restart starts from empty state and loads the file.
+	setup(t, stateFile)
+	if err := loadState(); err != nil {
+		t.Fatal(err)
+	}
+	loc := locationCache.location
+	if loc.City != "bangalore" || loc.Latitude == nil || *loc.Latitude != 12.97 || loc.Longitude == nil || *loc.Longitude != 77.59 {
+		t.Errorf("restored %+v, want bangalore at 12.97, 77.59", loc)
+	}
+
+	if w := request(t, http.MethodDelete, "/location/reset", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /location/reset: status %d", w.Code)
+	}
+	setup(t, stateFile)
+	if err := loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if loc := locationCache.location; loc.City != "" || loc.Latitude != nil {
+		t.Errorf("restored %+v after the reset, want none", loc)
+	}
+}
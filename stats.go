@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// WeightedStats extends Stats for ?weighted=true. WeightedSum is the sum of
+// weight*amount and WeightedAvg is WeightedSum divided by the total weight,
+// e.g. a volume-weighted average price when weights are volumes.
+type WeightedStats struct {
+	Stats
+	WeightedSum float64 `json:"weightedSum"`
+	WeightedAvg float64 `json:"weightedAvg"`
+}
+
+// filter returns the queued transactions of the current generation inside
+// the window for which match reports true.
+func (c *StatsCache) filter(now time.Time, match func(*Transaction) bool) []*Transaction {
+	generation := c.generation.Load()
+	var matched []*Transaction
+	for _, t := range c.queue {
+		if !t.expired(now) && t.generation == generation && match(t) {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// StatsSnapshot is a copy of the current generation's queue, taken under a
+// brief read lock. Queued transactions are never changed once accepted, so
+// the snapshot can be read without the lock while writers carry on.
+type StatsSnapshot struct {
+	Queue []*Transaction
+}
+
+// Snapshot copies the queue for lock-free reading.
+func (c *StatsCache) Snapshot() StatsSnapshot {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	generation := c.generation.Load()
+	queue := make([]*Transaction, 0, len(c.queue))
+	for _, t := range c.queue {
+		if t.generation == generation {
+			queue = append(queue, t)
+		}
+	}
+	return StatsSnapshot{Queue: queue}
+}
+
+// inWindow returns the snapshot's transactions inside the window at now.
+func (s StatsSnapshot) inWindow(now time.Time) []*Transaction {
+	var txs []*Transaction
+	for _, t := range s.Queue {
+		if !t.expired(now) {
+			txs = append(txs, t)
+		}
+	}
+	return txs
+}
+
+// previousWindow returns the queued transactions of the current generation
+// in the window before the current one for which match reports true.
+func (c *StatsCache) previousWindow(now time.Time, match func(*Transaction) bool) []*Transaction {
+	generation := c.generation.Load()
+	size := statsWindow()
+	var matched []*Transaction
+	for _, t := range c.queue {
+		age := now.Sub(t.Timestamp)
+		if age > size && age <= 2*size && t.generation == generation && match(t) {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// hasTimestamp reports whether a queued transaction inside the window has
+// exactly the timestamp ts.
+func (c *StatsCache) hasTimestamp(ts, now time.Time) bool {
+	for _, t := range c.filter(now, func(*Transaction) bool { return true }) {
+		if t.Timestamp.Equal(ts) {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregate computes the running statistics over txs, the same way they are
+// accumulated on ingestion.
+func aggregate(txs []*Transaction) Stats {
+	var stats Stats
+	for _, t := range txs {
+		stats.add(t)
+	}
+	return stats
+}
+
+// addToBucket adds t to the bucket for key, creating the map and the bucket
+// as needed, and returns the map.
+//
+// With config.MaxBuckets set, a new bucket is only created if hasRoom allows
+// it, and under the "evict" policy the least recently updated bucket makes
+// way for it.
+func addToBucket(buckets map[string]*StatsBucket, key string, t *Transaction, now time.Time) map[string]*StatsBucket {
+	if buckets == nil {
+		buckets = make(map[string]*StatsBucket)
+	}
+	bucket, ok := buckets[key]
+	if !ok {
+		if !hasRoom(buckets, key, now) {
+			return buckets
+		}
+		if config.MaxBuckets > 0 && len(buckets) >= config.MaxBuckets {
+			evictOldestBucket(buckets)
+		}
+		bucket = &StatsBucket{}
+		buckets[key] = bucket
+	}
+	bucket.stats.add(t)
+	bucket.lastUpdated = now
+	return buckets
+}
+
+// hasRoom reports whether buckets can take a bucket for key without going
+// over config.MaxBuckets, or by evicting one under the "evict" policy.
+// Buckets that have gone stale are pruned first.
+func hasRoom(buckets map[string]*StatsBucket, key string, now time.Time) bool {
+	if _, ok := buckets[key]; ok || config.MaxBuckets <= 0 {
+		return true
+	}
+	for k, bucket := range buckets {
+		if expired(bucket.lastUpdated, now) {
+			delete(buckets, k)
+		}
+	}
+	return len(buckets) < config.MaxBuckets || config.BucketOverflow == "evict"
+}
+
+func evictOldestBucket(buckets map[string]*StatsBucket) {
+	oldest := ""
+	for k, bucket := range buckets {
+		if oldest == "" || bucket.lastUpdated.Before(buckets[oldest].lastUpdated) {
+			oldest = k
+		}
+	}
+	delete(buckets, oldest)
+}
+
+// mergeBuckets combines the live buckets whose key matches into one Stats.
+func mergeBuckets(buckets map[string]*StatsBucket, now time.Time, match func(string) bool) Stats {
+	var merged Stats
+	for key, bucket := range buckets {
+		if match(key) && !expired(bucket.lastUpdated, now) {
+			merged.merge(bucket.stats)
+		}
+	}
+	return merged
+}
+
+// allCities merges every live city bucket. Transactions accepted while no
+// city was set are in no bucket, so this can count fewer than the global
+// statistics. The caller must hold the read lock.
+func allCities(now time.Time) Stats {
+	cities, _, _ := statsCache.buckets(now)
+	return mergeBuckets(cities, now, func(string) bool { return true })
+}
+
+// current returns the statistics of the window at now: the running ones,
+// empty once nothing has been accepted for a window, merged with the
+// transactions whose own TTL has not ended. Under config.LazyStats it is an
+// aggregate of the queue instead. The caller must hold the read lock.
+func (c *StatsCache) current(now time.Time) Stats {
+	if config.LazyStats {
+		return aggregate(c.filter(now, func(*Transaction) bool { return true }))
+	}
+	stats := c.stats
+	if expired(c.lastUpdated, now) {
+		stats = Stats{}
+	}
+	stats.merge(aggregate(c.liveTTL(now)))
+	return stats
+}
+
+// liveTTL returns the transactions of the current generation in ttlQueue
+// that have not expired at now.
+func (c *StatsCache) liveTTL(now time.Time) []*Transaction {
+	generation := c.generation.Load()
+	var live []*Transaction
+	for _, t := range c.ttlQueue {
+		if !t.expired(now) && t.generation == generation {
+			live = append(live, t)
+		}
+	}
+	return live
+}
+
+// buckets returns the city, geohash and currency buckets: the running ones,
+// or copies of them with the live transactions from ttlQueue added while
+// there are any. Under config.LazyStats they are built from the window at
+// now instead. The caller must hold the read lock.
+func (c *StatsCache) buckets(now time.Time) (cities, geohashes, currencies map[string]*StatsBucket) {
+	if config.LazyStats {
+		return addToBuckets(c.filter(now, func(*Transaction) bool { return true }), now, nil, nil, nil)
+	}
+	live := c.liveTTL(now)
+	if len(live) == 0 {
+		return c.cities, c.geohashes, c.currencies
+	}
+	return addToBuckets(live, now, liveBuckets(c.cities, now), liveBuckets(c.geohashes, now), liveBuckets(c.currencies, now))
+}
+
+// addToBuckets adds each of txs to its city, geohash and currency bucket,
+// and returns the maps.
+func addToBuckets(txs []*Transaction, now time.Time, cities, geohashes, currencies map[string]*StatsBucket) (map[string]*StatsBucket, map[string]*StatsBucket, map[string]*StatsBucket) {
+	for _, t := range txs {
+		if t.city != "" {
+			cities = addToBucket(cities, t.city, t, now)
+		}
+		if t.geohash != "" {
+			geohashes = addToBucket(geohashes, t.geohash, t, now)
+		}
+		if config.CurrencyStats && t.Currency != "" {
+			currencies = addToBucket(currencies, t.Currency, t, now)
+		}
+	}
+	return cities, geohashes, currencies
+}
+
+// liveBuckets copies the buckets that have not gone stale at now.
+func liveBuckets(buckets map[string]*StatsBucket, now time.Time) map[string]*StatsBucket {
+	live := make(map[string]*StatsBucket, len(buckets))
+	for key, bucket := range buckets {
+		if !expired(bucket.lastUpdated, now) {
+			copied := *bucket
+			live[key] = &copied
+		}
+	}
+	return live
+}
+
+// merge folds o into s as if o's transactions had been added to s.
+func (s *Stats) merge(o Stats) {
+	if o.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		*s = o
+		return
+	}
+
+	if o.firstAt.Before(s.firstAt) {
+		s.First, s.firstAt = o.First, o.firstAt
+	}
+	if !o.lastAt.Before(s.lastAt) {
+		s.Last, s.lastAt = o.Last, o.lastAt
+	}
+
+	s.Sum += o.Sum
+	s.Count += o.Count
+	if o.Max > s.Max {
+		s.Max = o.Max
+	}
+	if o.Min < s.Min {
+		s.Min = o.Min
+	}
+}
+
+// derive fills in the statistics computed from the running totals. Every
+// one is defined for any count: with no transactions they are all zero,
+// never NaN, and with one they equal its amount.
+func (s *Stats) derive() {
+	if s.Count == 0 {
+		s.Avg = 0
+		return
+	}
+	s.Avg = s.Sum / float64(s.Count)
+}
+
+// encodeStats fills in the derived fields and writes stats. When there is
+// nothing to report it writes "{}", or all-zero stats if config.ZeroEmptyStats
+// is set, and marks the response as not to be cached.
+func encodeStats(w http.ResponseWriter, r *http.Request, stats Stats) {
+	if stats.Count == 0 {
+		// The next transaction would change this, so it must not be reused.
+		w.Header().Set("Cache-Control", "no-cache")
+		if config.ZeroEmptyStats || acceptsProtobuf(r) {
+			writeStatsBody(w, r, Stats{})
+			return
+		}
+		if acceptsMsgpack(r) {
+			w.Header().Set("Content-Type", msgpackContentType)
+			w.Write(msgpackEmptyMap)
+			return
+		}
+		fmt.Fprintf(w, "{}")
+		return
+	}
+
+	stats.derive()
+
+	writeStatsBody(w, r, stats)
+}
+
+// writeStatsBody writes stats as protobuf or msgpack if the client accepts
+// either, and as JSON otherwise. Only JSON honours ?units=cents, ?fields=
+// and ?checksum=true, applied in that order.
+func writeStatsBody(w http.ResponseWriter, r *http.Request, stats Stats) {
+	if acceptsProtobuf(r) {
+		w.Header().Set("Content-Type", protobufContentType)
+		w.Write(stats.MarshalProto())
+		return
+	}
+	if acceptsMsgpack(r) {
+		w.Header().Set("Content-Type", msgpackContentType)
+		w.Write(stats.MarshalMsgpack())
+		return
+	}
+
+	var v any = stats
+	if inCents(r) {
+		v = centsStats(stats)
+	}
+	if fields, _ := projectedFields(r); fields != nil {
+		v = project(v, fields)
+	}
+	if wantsChecksum(r) {
+		writeChecksummed(w, v)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// decayExtremes sets DecayedMax and DecayedMin when config.DecayHalfLife is
+// set. Each transaction is pulled towards the average by its age, halving
+// its distance every half-life:
+//
+//	decayed = avg + (amount - avg) * 2^(-age/halfLife)
+//
+// and the extremes are taken over the decayed values. A new transaction
+// counts in full, while an old outlier fades towards the average instead of
+// holding Max or Min for the whole window.
+func decayExtremes(stats Stats, txs []*Transaction, now time.Time) Stats {
+	if config.DecayHalfLife <= 0 || stats.Count == 0 || len(txs) == 0 {
+		return stats
+	}
+
+	stats.derive()
+	avg := stats.Avg
+	var hi, lo float64
+	for i, t := range txs {
+		factor := math.Exp2(-float64(now.Sub(t.Timestamp)) / float64(config.DecayHalfLife))
+		decayed := avg + (t.Amount-avg)*min(factor, 1)
+		if i == 0 || decayed > hi {
+			hi = decayed
+		}
+		if i == 0 || decayed < lo {
+			lo = decayed
+		}
+	}
+	stats.DecayedMax, stats.DecayedMin = &hi, &lo
+	return stats
+}
+
+// withMedian sets the median of the window when config.Median is set. It
+// comes from the rolling median in constant time, or under config.LazyStats
+// from sorting the queue. The caller must hold the read lock.
+func withMedian(stats Stats, now time.Time) Stats {
+	if !config.Median {
+		return stats
+	}
+	if config.LazyStats {
+		if amounts := sortedAmounts(statsCache.filter(now, func(*Transaction) bool { return true })); len(amounts) > 0 {
+			median := percentile(amounts, 0.5, config.PercentileMethod)
+			stats.Median = &median
+		}
+	} else if median, ok := statsCache.median.median(now, config.PercentileMethod); ok {
+		stats.Median = &median
+	}
+	return stats
+}
+
+// publicStats prepares stats for /statistics. It records the window they
+// cover and withholds the numbers, keeping only the count, while fewer than
+// config.MinTransactions transactions are behind them.
+func publicStats(stats Stats) Stats {
+	if stats.Count > 0 && stats.Count < config.MinTransactions {
+		stats = Stats{Count: stats.Count, InsufficientData: true}
+	}
+	stats.WindowSeconds = statsWindow().Seconds()
+	return stats
+}
+
+// encodeWeightedStats writes WeightedStats, which are only available as JSON.
+func encodeWeightedStats(w http.ResponseWriter, r *http.Request, stats Stats, txs []*Transaction) {
+	if stats.Count == 0 || stats.InsufficientData {
+		encodeStats(w, r, stats)
+		return
+	}
+
+	stats.derive()
+	ws := WeightedStats{Stats: stats}
+
+	var totalWeight float64
+	for _, t := range txs {
+		weight := t.weight()
+		ws.WeightedSum += weight * t.Amount
+		totalWeight += weight
+	}
+	if totalWeight > 0 {
+		ws.WeightedAvg = ws.WeightedSum / totalWeight
+	}
+
+	json.NewEncoder(w).Encode(ws)
+}
+
+// CompareStats is returned by /statistics?compare=true: the current
+// window's statistics with the previous window's under "previous". Either is
+// "{}" when its window held no transactions.
+type CompareStats struct {
+	*Stats
+	Previous any `json:"previous"`
+}
+
+// encodeCompareStats writes CompareStats, which are only available as JSON.
+func encodeCompareStats(w http.ResponseWriter, current, previous Stats) {
+	var cs CompareStats
+	if current.Count > 0 {
+		current.derive()
+		cs.Stats = &current
+	}
+	cs.Previous = struct{}{}
+	if previous.Count > 0 {
+		previous.derive()
+		cs.Previous = previous
+	}
+
+	json.NewEncoder(w).Encode(cs)
+}
+
+// computeHandler aggregates a posted array of transactions without reading
+// or changing any server state. Timestamps are not checked against the
+// window.
+func computeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var transactions []Transaction
+	if !decodeJSON(w, r, &transactions) {
+		return
+	}
+
+	txs := make([]*Transaction, len(transactions))
+	for i := range transactions {
+		txs[i] = &transactions[i]
+	}
+
+	encodeStats(w, r, aggregate(txs))
+}
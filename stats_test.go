@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWeightedStats(t *testing.T) {
+	setup(t)
+	post(t, tx("100", testStart, `"weight":10`), http.StatusCreated)
+	post(t, tx("102", testStart, `"weight":30`), http.StatusCreated)
+	post(t, tx("98", testStart), http.StatusCreated)
+	post(t, tx("99", testStart, `"weight":-1`), http.StatusUnprocessableEntity)
+
+	w := request(t, http.MethodGet, "/statistics?weighted=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var stats WeightedStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	// 100*10 + 102*30 + 98*1 over a total weight of 41.
+	if stats.WeightedSum != 4158 || math.Abs(stats.WeightedAvg-4158.0/41) > 1e-9 {
+		t.Errorf("weighted sum %v and avg %v, want 4158 and %v", stats.WeightedSum, stats.WeightedAvg, 4158.0/41)
+	}
+	if stats.Sum != 300 || stats.Count != 3 {
+		t.Errorf("sum %v and count %d, want 300 and 3", stats.Sum, stats.Count)
+	}
+}
+
+func TestMinTransactions(t *testing.T) {
+	setup(t, "MIN_TRANSACTIONS=3", "MEDIAN=true")
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("20", testStart), http.StatusCreated)
+
+	stats := getStats(t, "/statistics?include=p95")
+	if !stats.InsufficientData || stats.Count != 2 || stats.Sum != 0 || stats.Avg != 0 || stats.Median != nil || stats.P95 != nil {
+		t.Errorf("at 2 transactions: %+v, want only the count", stats)
+	}
+
+	post(t, tx("30", testStart), http.StatusCreated)
+	stats = getStats(t, "/statistics?include=p95")
+	if stats.InsufficientData || stats.Count != 3 || stats.Sum != 60 || stats.Avg != 20 || stats.Median == nil || stats.P95 == nil {
+		t.Errorf("at 3 transactions: %+v, want the full statistics", stats)
+	}
+}
+
+func TestWindowSeconds(t *testing.T) {
+	setup(t, "WINDOW=30s", "API_KEY=secret")
+	post(t, tx("10", testStart), http.StatusCreated)
+	if stats := getStats(t, "/statistics"); stats.WindowSeconds != 30 {
+		t.Errorf("window %v seconds, want 30", stats.WindowSeconds)
+	}
+
+	if w := request(t, http.MethodPut, "/admin/config/window", `{"window":"2m"}`, "X-API-Key: secret"); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT /admin/config/window: status %d: %s", w.Code, w.Body)
+	}
+	if stats := getStats(t, "/statistics"); stats.WindowSeconds != 120 {
+		t.Errorf("after the change: window %v seconds, want 120", stats.WindowSeconds)
+	}
+}
+
+func TestDerivedStatsAtZeroAndOne(t *testing.T) {
+	env := []string{"ZERO_EMPTY_STATS=true", "MEDIAN=true", "DECAY_HALF_LIFE=30s"}
+
+	t.Run("none", func(t *testing.T) {
+		setup(t, env...)
+		var stats Stats
+		stats.derive()
+		if stats.Avg != 0 {
+			t.Errorf("derived avg %v, want 0", stats.Avg)
+		}
+		if got := getStats(t, "/statistics?include=p95"); !reflect.DeepEqual(got, Stats{}) {
+			t.Errorf("%+v, want all zero", got)
+		}
+	})
+
+	t.Run("one", func(t *testing.T) {
+		setup(t, env...)
+		post(t, tx("12.5", testStart.Add(-10*time.Second)), http.StatusCreated)
+		stats := getStats(t, "/statistics?include=p95")
+		for name, value := range map[string]*float64{
+			"sum": &stats.Sum, "avg": &stats.Avg, "max": &stats.Max, "min": &stats.Min,
+			"first": &stats.First, "last": &stats.Last, "median": stats.Median, "p95": stats.P95,
+			"decayedMax": stats.DecayedMax, "decayedMin": stats.DecayedMin,
+		} {
+			if value == nil || *value != 12.5 {
+				t.Errorf("%s %v, want 12.5", name, value)
+			}
+		}
+	})
+
+	t.Run("one weightless", func(t *testing.T) {
+		setup(t, env...)
+		post(t, tx("12.5", testStart, `"weight":0`), http.StatusCreated)
+		w := request(t, http.MethodGet, "/statistics?weighted=true", "")
+		var stats WeightedStats
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+		if stats.WeightedSum != 0 || stats.WeightedAvg != 0 || stats.Avg != 12.5 {
+			t.Errorf("%+v, want zero weighted statistics", stats)
+		}
+	})
+}
+
+// BenchmarkWriteDuringRead measures writes while another goroutine keeps
+// sorting the window, once holding the read lock for the sort and once
+// sorting a snapshot.
+func BenchmarkWriteDuringRead(b *testing.B) {
+	reads := map[string]func(){
+		"locked": func() {
+			statsCache.lock.RLock()
+			sortedAmounts(statsCache.filter(testStart, func(*Transaction) bool { return true }))
+			statsCache.lock.RUnlock()
+		},
+		"snapshot": func() {
+			sortedAmounts(statsCache.Snapshot().inWindow(testStart))
+		},
+	}
+	for name, read := range reads {
+		b.Run(name, func(b *testing.B) {
+			setup(b, "WINDOW=1h")
+			statsCache.lock.Lock()
+			for i := range 20000 {
+				statsCache.accept(&Transaction{Amount: float64(i), Timestamp: testStart}, testStart)
+			}
+			statsCache.lock.Unlock()
+
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						read()
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			for i := range b.N {
+				statsCache.lock.Lock()
+				statsCache.accept(&Transaction{Amount: float64(i), Timestamp: testStart}, testStart)
+				statsCache.lock.Unlock()
+			}
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
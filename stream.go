@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// streamFlushEvery is how many items the streaming handlers write between
+// flushes.
+const streamFlushEvery = 500
+
+// streamingRoutes are the paths that stream their responses. They are never
+// given a timeout, since http.TimeoutHandler buffers the whole response and
+// cannot flush.
+var streamingRoutes = []string{"/transactions/export.csv", "/statistics/timeseries", "/statistics/rollups"}
+
+// streamJSONArray writes n items as a JSON array, one at a time, flushing
+// every streamFlushEvery items so the client starts receiving data before
+// the array is complete. It stops at the first write error, which usually
+// means the client has gone away.
+func streamJSONArray(w http.ResponseWriter, n int, item func(i int) any) error {
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+
+	if _, err := w.Write([]byte("[")); err != nil {
+		return err
+	}
+	for i := range n {
+		b, err := json.Marshal(item(i))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b = append([]byte(","), b...)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if flusher != nil && (i+1)%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	_, err := w.Write([]byte("]\n"))
+	return err
+}
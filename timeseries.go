@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type TimeSeriesBin struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Sum   float64   `json:"sum"`
+}
+
+// maxTimeSeriesBins is the most buckets one /statistics/timeseries request
+// may split its span into.
+const maxTimeSeriesBins = 10000
+
+// timeSeriesHandler splits the last ?span= (the window by default, at most
+// the retention period) into equal buckets (?bucket=5s by default), at most
+// maxTimeSeriesBins of them, and reports the count and sum of the queued
+// transactions in each. Every bucket is present, so empty ones come back as
+// zeros. The bins are computed from a snapshot of the queue, so writers are
+// not held up.
+func timeSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !locationAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	bucket := time.Second * 5
+	if raw := query.Get("bucket"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid bucket", http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+	size := statsWindow()
+	if raw := query.Get("span"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > retention() {
+			http.Error(w, "Span must be a positive duration within the retention period", http.StatusBadRequest)
+			return
+		}
+		size = d
+	}
+	if size%bucket != 0 {
+		http.Error(w, "Bucket must divide the span evenly", http.StatusBadRequest)
+		return
+	}
+	if size/bucket > maxTimeSeriesBins {
+		http.Error(w, "Bucket is too small, the span can hold at most "+strconv.Itoa(maxTimeSeriesBins)+" buckets", http.StatusBadRequest)
+		return
+	}
+
+	flushWrites()
+
+	now := clock()
+	start := now.Add(-size)
+	bins := make([]TimeSeriesBin, size/bucket)
+	for i := range bins {
+		bins[i].Start = start.Add(time.Duration(i) * bucket)
+	}
+
+	for _, t := range statsCache.Snapshot().Queue {
+		if t.Timestamp.Before(start) || t.Timestamp.After(now) {
+			continue
+		}
+		i := int(t.Timestamp.Sub(start) / bucket)
+		if i == len(bins) {
+			i--
+		}
+		bins[i].Count++
+		bins[i].Sum += t.Amount
+	}
+
+	streamJSONArray(w, len(bins), func(i int) any { return bins[i] })
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimeSeries(t *testing.T) {
+	setup(t)
+	post(t, tx("10", testStart.Add(-55*time.Second)), http.StatusCreated)
+	post(t, tx("20", testStart.Add(-5*time.Second)), http.StatusCreated)
+	post(t, tx("30", testStart.Add(-5*time.Second)), http.StatusCreated)
+	post(t, tx("5", testStart), http.StatusCreated)
+
+	w := request(t, http.MethodGet, "/statistics/timeseries?bucket=10s", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var bins []TimeSeriesBin
+	if err := json.Unmarshal(w.Body.Bytes(), &bins); err != nil {
+		t.Fatal(err)
+	}
+
+	// The empty buckets in between are zeros, and a transaction stamped now
+	// falls in the last.
+	start := testStart.Add(-time.Minute)
+	want := []TimeSeriesBin{
+		{start, 1, 10},
+		{start.Add(10 * time.Second), 0, 0},
+		{start.Add(20 * time.Second), 0, 0},
+		{start.Add(30 * time.Second), 0, 0},
+		{start.Add(40 * time.Second), 0, 0},
+		{start.Add(50 * time.Second), 3, 55},
+	}
+	if !slices.EqualFunc(bins, want, func(a, b TimeSeriesBin) bool {
+		return a.Start.Equal(b.Start) && a.Count == b.Count && a.Sum == b.Sum
+	}) {
+		t.Errorf("%+v, want %+v", bins, want)
+	}
+}
+
+func TestTimeSeriesParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"bucket=7s", http.StatusBadRequest},
+		{"bucket=0s", http.StatusBadRequest},
+		{"bucket=-5s", http.StatusBadRequest},
+		{"bucket=five", http.StatusBadRequest},
+		{"span=2m", http.StatusBadRequest},
+		{"span=30s&bucket=10s", http.StatusOK},
+		// 10000 buckets is the most one span may hold.
+		{"bucket=6ms", http.StatusOK},
+		{"bucket=5ms", http.StatusBadRequest},
+		{"bucket=1ns", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setup(t)
+			if w := request(t, http.MethodGet, "/statistics/timeseries?"+tt.query, ""); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNullAmount rejects "amount": null when config.RejectNullAmount is set,
+// as opposed to a missing amount, which still decodes as zero.
+var errNullAmount = errors.New("Transaction amount must not be null")
+
+// errAmountNotFinite rejects an amount too large for a float64, such as
+// 1e400, which would otherwise turn the running Sum into +Inf or NaN for
+// good.
+var errAmountNotFinite = errors.New("Transaction amount must be a finite number")
+
+// UnmarshalJSON decodes a transaction, reading the amount and timestamp from
+// the keys named by config.AmountField and config.TimestampField. When a key
+// has been renamed, payloads without it are rejected so that a misconfigured
+// name cannot silently zero every transaction.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type alias Transaction
+	aux := struct {
+		*alias
+		Amount    json.RawMessage `json:"amount"`
+		Timestamp json.RawMessage `json:"timestamp"`
+		TTL       string          `json:"ttl"`
+	}{alias: (*alias)(t)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.TTL != "" {
+		ttl, err := time.ParseDuration(aux.TTL)
+		if err != nil {
+			return fmt.Errorf("invalid transaction ttl: %w", err)
+		}
+		t.ttl = ttl
+	}
+
+	if err := t.migrate(); err != nil {
+		return err
+	}
+
+	amount, timestamp := aux.Amount, aux.Timestamp
+	if config.AmountField != "amount" || config.TimestampField != "timestamp" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		var err error
+		if amount, err = renamedField(fields, config.AmountField, "amount"); err != nil {
+			return err
+		}
+		if timestamp, err = renamedField(fields, config.TimestampField, "timestamp"); err != nil {
+			return err
+		}
+	}
+
+	if len(timestamp) > 0 && string(timestamp) != "null" {
+		if err := json.Unmarshal(timestamp, &t.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	if string(amount) == "null" && config.RejectNullAmount {
+		return errNullAmount
+	}
+	if len(amount) == 0 || string(amount) == "null" {
+		return nil
+	}
+	if amount[0] == '"' {
+		return errors.New("transaction amount must be a JSON number")
+	}
+
+	value, err := strconv.ParseFloat(string(amount), 64)
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return errAmountNotFinite
+	}
+	if err != nil {
+		return err
+	}
+	t.Amount = value
+	t.rawAmount = string(amount)
+	return nil
+}
+
+// expired reports whether t has fallen out of the window at now, using its
+// own TTL in place of the window when it has one. A tumbling window ends
+// even a transaction with a longer TTL.
+func (t *Transaction) expired(now time.Time) bool {
+	if t.ttl > 0 {
+		if now.Sub(t.Timestamp) > t.ttl {
+			return true
+		}
+		if config.WindowMode != windowTumbling {
+			return false
+		}
+	}
+	return expired(t.Timestamp, now)
+}
+
+// normalize applies the configured input normalization before t is
+// validated. A transaction sent without a timestamp is dated at now when
+// config.DefaultTimestampNow is set, and otherwise keeps the zero time, which
+// is always too old to be counted. With config.RoundAmounts set, the amount
+// is rounded to that many decimal places.
+func (t *Transaction) normalize(now time.Time) {
+	if config.DefaultTimestampNow && t.Timestamp.IsZero() {
+		t.Timestamp = now
+	}
+	if config.RoundAmounts >= 0 && t.rawAmount != "" {
+		if rounded, ok := roundDecimal(t.rawAmount, config.RoundAmounts, config.RoundingMode); ok {
+			t.rawAmount = rounded
+			t.Amount, _ = strconv.ParseFloat(rounded, 64)
+		}
+	}
+}
+
+// Rounding modes for config.RoundingMode. Both round to the nearest value
+// at the scale and differ only on ties: "half-even" rounds a tie to the
+// even neighbour, so 10.005 and 10.015 become 10.00 and 10.02, while
+// "half-up" rounds a tie away from zero, so 10.005 becomes 10.01 and
+// -10.005 becomes -10.01.
+const (
+	roundHalfEven = "half-even"
+	roundHalfUp   = "half-up"
+)
+
+// roundDecimal rounds the decimal number raw to scale places using exact
+// decimal arithmetic, so that a tie such as 10.005 is seen as one even though
+// it has no exact float64 form.
+func roundDecimal(raw string, scale int, mode string) (string, bool) {
+	r, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return "", false
+	}
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	r.Mul(r, new(big.Rat).SetInt(pow))
+
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	twice := new(big.Int).Abs(m)
+	twice.Lsh(twice, 1)
+	switch cmp := twice.Cmp(r.Denom()); {
+	case cmp > 0, cmp == 0 && (mode == roundHalfUp || q.Bit(0) == 1):
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+
+	return new(big.Rat).SetFrac(q, pow).FloatString(scale), true
+}
+
+func renamedField(fields map[string]json.RawMessage, name, def string) (json.RawMessage, error) {
+	value, ok := fields[name]
+	if !ok && name != def {
+		return nil, fmt.Errorf("transaction is missing %q", name)
+	}
+	return value, nil
+}
+
+// amountExact reports whether the float64 amount still denotes the decimal
+// number written in the request, to the precision it was written with. It
+// fails for integers past 2^53 such as 9007199254740993, which round to a
+// neighbouring value.
+func amountExact(raw string, amount float64) bool {
+	want, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return false
+	}
+	got, ok := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', amountScale(raw), 64))
+	return ok && want.Cmp(got) == 0
+}
+
+// amountScale returns the number of significant decimal places in a JSON
+// number, so "10.990" and "1099e-2" both have a scale of 2.
+func amountScale(raw string) int {
+	mantissa, exponent := raw, 0
+	if i := strings.IndexAny(raw, "eE"); i >= 0 {
+		mantissa = raw[:i]
+		exponent, _ = strconv.Atoi(raw[i+1:])
+	}
+	mantissa = strings.TrimLeft(mantissa, "-")
+
+	digits, frac := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		digits, frac = mantissa[:i]+mantissa[i+1:], mantissa[i+1:]
+	}
+
+	scale := len(frac) - exponent
+	for scale > 0 && strings.HasSuffix(digits, "0") {
+		digits = digits[:len(digits)-1]
+		scale--
+	}
+	if scale < 0 {
+		return 0
+	}
+	return scale
+}
+
+const (
+	maxMetadataEntries  = 16
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 256
+)
+
+func (t *Transaction) validateMetadata() error {
+	if len(t.Metadata) > maxMetadataEntries {
+		return fmt.Errorf("Transaction metadata has more than %d entries", maxMetadataEntries)
+	}
+	for key, value := range t.Metadata {
+		if key == "" || len(key) > maxMetadataKeyLen {
+			return fmt.Errorf("Transaction metadata keys must be 1 to %d bytes", maxMetadataKeyLen)
+		}
+		if len(value) > maxMetadataValueLen {
+			return fmt.Errorf("Transaction metadata values must be at most %d bytes", maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// field returns the value of a groupable transaction field, reporting false
+// for names that cannot be grouped on.
+func (t *Transaction) field(name string) (string, bool) {
+	switch name {
+	case "type":
+		return t.Type, true
+	case "category":
+		return t.Category, true
+	case "currency":
+		return t.Currency, true
+	case "city":
+		return t.city, true
+	case "source":
+		return t.source, true
+	}
+	return "", false
+}
+
+func (t *Transaction) weight() float64 {
+	if t.Weight == nil {
+		return 1
+	}
+	return *t.Weight
+}
+
+func (t *Transaction) hasMetadata(meta map[string]string) bool {
+	for key, value := range meta {
+		if v, ok := t.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataFilter collects the meta.<key>=<value> query parameters.
+func metadataFilter(query url.Values) map[string]string {
+	meta := make(map[string]string)
+	for name, values := range query {
+		if key, ok := strings.CutPrefix(name, "meta."); ok && len(values) > 0 {
+			meta[key] = values[0]
+		}
+	}
+	return meta
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAmountScale(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{"10", 0},
+		{"10.99", 2},
+		{"10.990", 2},
+		{"1099e-2", 2},
+		{"-0.125", 3},
+		{"1.5E3", 0},
+	}
+	for _, tt := range tests {
+		if got := amountScale(tt.raw); got != tt.want {
+			t.Errorf("amountScale(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestExactAmounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    []string
+		amount string
+		want   int
+	}{
+		{"2^53", []string{"EXACT_AMOUNTS=true"}, "9007199254740992", http.StatusCreated},
+		{"2^53+1", []string{"EXACT_AMOUNTS=true"}, "9007199254740993", http.StatusUnprocessableEntity},
+		{"2^53+1 unchecked", nil, "9007199254740993", http.StatusCreated},
+		{"decimal", []string{"EXACT_AMOUNTS=true"}, "0.1", http.StatusCreated},
+		{"exponent", []string{"EXACT_AMOUNTS=true"}, "12345e-2", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			post(t, tx(tt.amount, testStart), tt.want)
+		})
+	}
+}
+
+func TestMissingTimestamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   []string
+		body  string
+		want  int
+		count int
+	}{
+		{"missing", nil, `{"amount":10}`, http.StatusNoContent, 0},
+		{"zero", nil, `{"amount":10,"timestamp":"0001-01-01T00:00:00Z"}`, http.StatusNoContent, 0},
+		{"missing as now", []string{"DEFAULT_TIMESTAMP_NOW=true"}, `{"amount":10}`, http.StatusCreated, 1},
+		{"zero as now", []string{"DEFAULT_TIMESTAMP_NOW=true"}, `{"amount":10,"timestamp":"0001-01-01T00:00:00Z"}`, http.StatusCreated, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			post(t, tt.body, tt.want)
+			if stats := getStats(t, "/statistics"); stats.Count != tt.count {
+				t.Errorf("count %d, want %d", stats.Count, tt.count)
+			}
+		})
+	}
+}
+
+func TestNullAmount(t *testing.T) {
+	ts := `"timestamp":"` + testStart.Format(time.RFC3339) + `"`
+	tests := []struct {
+		name  string
+		env   []string
+		body  string
+		want  int
+		count int
+	}{
+		{"null", []string{"REJECT_NULL_AMOUNT=true"}, `{"amount":null,` + ts + `}`, http.StatusBadRequest, 0},
+		{"missing", []string{"REJECT_NULL_AMOUNT=true"}, `{` + ts + `}`, http.StatusCreated, 1},
+		{"zero", []string{"REJECT_NULL_AMOUNT=true"}, `{"amount":0,` + ts + `}`, http.StatusCreated, 1},
+		{"null allowed", nil, `{"amount":null,` + ts + `}`, http.StatusCreated, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			w := post(t, tt.body, tt.want)
+			if tt.want == http.StatusBadRequest && strings.TrimSpace(w.Body.String()) != errNullAmount.Error() {
+				t.Errorf("body %q, want %q", w.Body, errNullAmount)
+			}
+			if stats := getStats(t, "/statistics"); stats.Count != tt.count {
+				t.Errorf("count %d, want %d", stats.Count, tt.count)
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	tc := setup(t)
+	setCity(t, "bangalore")
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("1", testStart, `"ttl":"10s"`), http.StatusCreated)
+	post(t, tx("100", testStart.Add(-5*time.Second), `"ttl":"30s"`), http.StatusCreated)
+	post(t, tx("5", testStart.Add(-20*time.Second), `"ttl":"10s"`), http.StatusNoContent)
+	post(t, tx("5", testStart, `"ttl":"2m"`), http.StatusUnprocessableEntity)
+	post(t, tx("5", testStart, `"ttl":"-1s"`), http.StatusUnprocessableEntity)
+
+	tests := []struct {
+		after time.Duration
+		count int
+		sum   float64
+	}{
+		{0, 3, 111},
+		{10 * time.Second, 3, 111},
+		{11 * time.Second, 2, 110},
+		{26 * time.Second, 1, 10},
+		{61 * time.Second, 0, 0},
+	}
+	elapsed := time.Duration(0)
+	for _, tt := range tests {
+		tc.advance(tt.after - elapsed)
+		elapsed = tt.after
+		for _, target := range []string{"/statistics", "/statistics?city=*"} {
+			if stats := getStats(t, target); stats.Count != tt.count || stats.Sum != tt.sum {
+				t.Errorf("%s after %v: count %d and sum %v, want %d and %v", target, tt.after, stats.Count, stats.Sum, tt.count, tt.sum)
+			}
+		}
+	}
+}
+
+func TestTTLWithSampling(t *testing.T) {
+	setup(t, "SAMPLE_SIZE=2")
+	for _, amount := range []string{"1", "2", "3", "4", "5"} {
+		post(t, tx(amount, testStart), http.StatusCreated)
+	}
+	post(t, tx("100", testStart, `"ttl":"10s"`), http.StatusCreated)
+
+	// The running statistics stay exact; only the TTL transaction is added
+	// from the queue.
+	if stats := getStats(t, "/statistics"); stats.Count != 6 || stats.Sum != 115 {
+		t.Errorf("count %d and sum %v, want 6 and 115", stats.Count, stats.Sum)
+	}
+}
+
+func TestRoundDecimal(t *testing.T) {
+	tests := []struct {
+		raw, mode, want string
+	}{
+		{"10.005", roundHalfEven, "10.00"},
+		{"10.015", roundHalfEven, "10.02"},
+		{"10.0051", roundHalfEven, "10.01"},
+		{"-10.005", roundHalfEven, "-10.00"},
+		{"10.005", roundHalfUp, "10.01"},
+		{"-10.005", roundHalfUp, "-10.01"},
+		{"10.004", roundHalfUp, "10.00"},
+		{"1e-3", roundHalfUp, "0.00"},
+		{"7", roundHalfUp, "7.00"},
+	}
+	for _, tt := range tests {
+		if got, ok := roundDecimal(tt.raw, 2, tt.mode); !ok || got != tt.want {
+			t.Errorf("roundDecimal(%q, 2, %s) = %q, want %q", tt.raw, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestRoundAmounts(t *testing.T) {
+	tests := []struct {
+		mode string
+		want float64
+	}{
+		{roundHalfEven, 10},
+		{roundHalfUp, 10.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			setup(t, "ROUND_AMOUNTS=2", "ROUNDING_MODE="+tt.mode, "MAX_AMOUNT_SCALE=2")
+			// Rounding comes before the scale check, so 10.005 passes it.
+			post(t, tx("10.005", testStart), http.StatusCreated)
+			if stats := getStats(t, "/statistics"); stats.Sum != tt.want {
+				t.Errorf("sum %v, want %v", stats.Sum, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonFiniteAmount(t *testing.T) {
+	setup(t)
+	post(t, tx("10", testStart), http.StatusCreated)
+	for _, amount := range []string{"1e400", "-1e400"} {
+		w := post(t, tx(amount, testStart), http.StatusUnprocessableEntity)
+		if body := strings.TrimSpace(w.Body.String()); body != errAmountNotFinite.Error() {
+			t.Errorf("%s: body %q, want %q", amount, body, errAmountNotFinite)
+		}
+	}
+	post(t, tx("20", testStart), http.StatusCreated)
+
+	if stats := getStats(t, "/statistics"); stats.Count != 2 || stats.Sum != 30 || stats.Avg != 15 || stats.Max != 20 || stats.Min != 10 {
+		t.Errorf("%+v, want the two finite transactions", stats)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ValidationError is a rule's reason for rejecting a transaction, with the
+// status transactionsHandler answers it with.
+type ValidationError struct {
+	Status  int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// A Validator is one rule a transaction must pass before it is counted. It
+// returns nil when t is acceptable at now.
+type Validator func(t *Transaction, now time.Time) *ValidationError
+
+// validators are run in order; the first failure decides the response.
+var validators = []Validator{
+	checkWeight,
+	checkMetadata,
+	checkScale,
+	checkExact,
+	checkTTL,
+	checkSign,
+	checkCurrency,
+	checkAge,
+}
+
+func invalid(message string) *ValidationError {
+	return &ValidationError{Status: http.StatusUnprocessableEntity, Message: message}
+}
+
+// firstProblem runs the validators against t at now and returns the first
+// failure, or nil if there is none.
+func firstProblem(t *Transaction, now time.Time) *ValidationError {
+	for _, validate := range validators {
+		if err := validate(t, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTransaction returns every reason transactionsHandler would reject t
+// at now, in the order the handler checks them.
+func validateTransaction(t *Transaction, now time.Time) []string {
+	var problems []string
+	for _, validate := range validators {
+		if err := validate(t, now); err != nil {
+			problems = append(problems, err.Message)
+		}
+	}
+	return problems
+}
+
+func checkWeight(t *Transaction, now time.Time) *ValidationError {
+	if t.Weight != nil && *t.Weight < 0 {
+		return invalid("Transaction weight must not be negative")
+	}
+	return nil
+}
+
+func checkMetadata(t *Transaction, now time.Time) *ValidationError {
+	if err := t.validateMetadata(); err != nil {
+		return invalid(err.Error())
+	}
+	return nil
+}
+
+func checkScale(t *Transaction, now time.Time) *ValidationError {
+	if config.MaxAmountScale >= 0 && amountScale(t.rawAmount) > config.MaxAmountScale {
+		return invalid("Transaction amount has too many decimal places")
+	}
+	return nil
+}
+
+func checkExact(t *Transaction, now time.Time) *ValidationError {
+	if config.ExactAmounts && t.rawAmount != "" && !amountExact(t.rawAmount, t.Amount) {
+		return invalid("Transaction amount cannot be represented exactly")
+	}
+	return nil
+}
+
+func checkTTL(t *Transaction, now time.Time) *ValidationError {
+	if t.ttl < 0 {
+		return invalid("Transaction ttl must be positive")
+	}
+	if t.ttl > retention() {
+		return invalid("Transaction ttl exceeds the retention period")
+	}
+	return nil
+}
+
+func checkSign(t *Transaction, now time.Time) *ValidationError {
+	if sign, ok := config.SignRules[t.Type]; ok && t.Type != "" {
+		if sign == signPositive && !(t.Amount > 0) || sign == signNegative && !(t.Amount < 0) {
+			return invalid("Transaction amount must be " + sign + " for type " + t.Type)
+		}
+	}
+	return nil
+}
+
+func checkCurrency(t *Transaction, now time.Time) *ValidationError {
+	if config.CurrencyStats && t.Currency != "" && !isoCurrencies[t.Currency] {
+		return invalid("Transaction currency is not an ISO 4217 code")
+	}
+	return nil
+}
+
+func checkAge(t *Transaction, now time.Time) *ValidationError {
+	if problem := ageProblem(t, now); problem != "" {
+		return invalid(problem)
+	}
+	return nil
+}
+
+// ageProblem checks the age of t against config.MinAge and config.MaxAge.
+func ageProblem(t *Transaction, now time.Time) string {
+	switch age := now.Sub(t.Timestamp); {
+	case age < config.MinAge && age < 0:
+		return "Transaction timestamp is in the future"
+	case age < config.MinAge:
+		return "Transaction timestamp is too new, it must be at least " + config.MinAge.String() + " old"
+	case config.MaxAge > 0 && age > config.MaxAge:
+		return "Transaction timestamp is too old, it must be at most " + config.MaxAge.String() + " old"
+	}
+	return ""
+}
+
+type ValidationResult struct {
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// validateHandler runs the checks of transactionsHandler against a posted
+// transaction without recording it. A transaction too old to be counted is
+// reported as a problem even though transactionsHandler may answer it with
+// 204 or 202.
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result ValidationResult
+
+	var transaction Transaction
+	err := json.NewDecoder(r.Body).Decode(&transaction)
+	switch {
+	case errors.Is(err, io.EOF):
+		result.Problems = []string{"Request body is empty"}
+	case err != nil:
+		result.Problems = []string{"Invalid JSON: " + err.Error()}
+	default:
+		now := clock()
+		transaction.normalize(now)
+		result.Problems = validateTransaction(&transaction, now)
+		if ageProblem(&transaction, now) == "" && transaction.expired(now) {
+			result.Problems = append(result.Problems, "Transaction timestamp is older than the window and would not be counted")
+		}
+	}
+
+	result.Valid = len(result.Problems) == 0
+	if !result.Valid {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(result)
+}
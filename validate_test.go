@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxAmountScale(t *testing.T) {
+	tests := []struct {
+		scale  string
+		amount string
+		want   int
+	}{
+		{"2", "10.999", http.StatusUnprocessableEntity},
+		{"2", "10.99", http.StatusCreated},
+		{"2", "10", http.StatusCreated},
+		{"0", "10.5", http.StatusUnprocessableEntity},
+		{"-1", "10.999", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scale+"/"+tt.amount, func(t *testing.T) {
+			setup(t, "MAX_AMOUNT_SCALE="+tt.scale)
+			post(t, tx(tt.amount, testStart), tt.want)
+		})
+	}
+}
+
+func TestAgeRange(t *testing.T) {
+	tests := []struct {
+		name string
+		age  time.Duration
+		want string
+	}{
+		{"future", -time.Nanosecond, "Transaction timestamp is in the future"},
+		{"too new", 5*time.Second - time.Nanosecond, "Transaction timestamp is too new, it must be at least 5s old"},
+		{"min age", 5 * time.Second, ""},
+		{"max age", 30 * time.Second, ""},
+		{"too old", 30*time.Second + time.Nanosecond, "Transaction timestamp is too old, it must be at most 30s old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, "MIN_AGE=5s", "MAX_AGE=30s")
+			if tt.want == "" {
+				post(t, tx("10", testStart.Add(-tt.age)), http.StatusCreated)
+				return
+			}
+			w := post(t, tx("10", testStart.Add(-tt.age)), http.StatusUnprocessableEntity)
+			if body := strings.TrimSpace(w.Body.String()); body != tt.want {
+				t.Errorf("body %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignRules(t *testing.T) {
+	tests := []struct {
+		amount, typ string
+		want        int
+	}{
+		{"10", "credit", http.StatusCreated},
+		{"-10", "credit", http.StatusUnprocessableEntity},
+		{"0", "credit", http.StatusUnprocessableEntity},
+		{"-10", "debit", http.StatusCreated},
+		{"10", "debit", http.StatusUnprocessableEntity},
+		{"-10", "fee", http.StatusCreated},
+		{"10", "", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+"/"+tt.amount, func(t *testing.T) {
+			setup(t, "SIGN_RULES=credit=positive,debit=negative")
+			post(t, tx(tt.amount, testStart, `"type":"`+tt.typ+`"`), tt.want)
+		})
+	}
+}
+
+func TestValidatorOrder(t *testing.T) {
+	setup(t, "MAX_AMOUNT_SCALE=2", "EXACT_AMOUNTS=true", "SIGN_RULES=credit=positive", "CURRENCY_STATS=true")
+	weight := -1.0
+	bad := Transaction{
+		Amount:    -9007199254740993,
+		rawAmount: "-9007199254740993.001",
+		Timestamp: testStart.Add(time.Hour),
+		Weight:    &weight,
+		Metadata:  map[string]string{"": "x"},
+		Type:      "credit",
+		Currency:  "ABC",
+		ttl:       -time.Second,
+	}
+	want := []string{
+		"Transaction weight must not be negative",
+		"Transaction metadata keys must be 1 to 64 bytes",
+		"Transaction amount has too many decimal places",
+		"Transaction amount cannot be represented exactly",
+		"Transaction ttl must be positive",
+		"Transaction amount must be positive for type credit",
+		"Transaction currency is not an ISO 4217 code",
+		"Transaction timestamp is in the future",
+	}
+	if len(validators) != len(want) {
+		t.Fatalf("%d validators, want %d", len(validators), len(want))
+	}
+
+	problems := validateTransaction(&bad, testStart)
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Each rule rejects it for its own reason alone and accepts a valid
+	// transaction. The first failure decides the response.
+	for i, validate := range validators {
+		if err := validate(&bad, testStart); err == nil || err.Message != want[i] || err.Status != http.StatusUnprocessableEntity {
+			t.Errorf("validator %d: %v, want %q", i, err, want[i])
+		}
+		if err := validate(&Transaction{Amount: 1, rawAmount: "1", Timestamp: testStart, Type: "credit", Currency: "USD"}, testStart); err != nil {
+			t.Errorf("validator %d rejected a valid transaction: %v", i, err)
+		}
+	}
+	if err := firstProblem(&bad, testStart); err == nil || err.Message != want[0] {
+		t.Errorf("first problem %v, want %q", err, want[0])
+	}
+}
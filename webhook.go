@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ThresholdRule is a condition on one statistic, such as avg>100, written
+// as stat, operator and number with no spaces.
+type ThresholdRule struct {
+	Stat  string
+	Op    string
+	Value float64
+}
+
+// Statistics and operators a ThresholdRule may use. Longer operators come
+// first so that ">=" is not read as ">".
+var (
+	thresholdStats = []string{"sum", "avg", "max", "min", "count"}
+	thresholdOps   = []string{">=", "<=", ">", "<"}
+)
+
+func (t ThresholdRule) String() string {
+	return t.Stat + t.Op + strconv.FormatFloat(t.Value, 'g', -1, 64)
+}
+
+func (t ThresholdRule) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// holds reports whether stats, with derived fields filled in, meet the rule.
+func (t ThresholdRule) holds(stats Stats) bool {
+	var v float64
+	switch t.Stat {
+	case "sum":
+		v = stats.Sum
+	case "avg":
+		v = stats.Avg
+	case "max":
+		v = stats.Max
+	case "min":
+		v = stats.Min
+	case "count":
+		v = float64(stats.Count)
+	}
+	switch t.Op {
+	case ">=":
+		return v >= t.Value
+	case "<=":
+		return v <= t.Value
+	case ">":
+		return v > t.Value
+	}
+	return v < t.Value
+}
+
+// Alert is the body POSTed to config.WebhookURL when a rule starts to hold.
+type Alert struct {
+	Rule  ThresholdRule `json:"rule"`
+	Time  time.Time     `json:"time"`
+	Stats Stats         `json:"stats"`
+}
+
+// webhookAttempts is how many times an alert is sent before it is given
+// up on, waiting twice as long after each failure, starting at
+// webhookBackoff.
+const webhookAttempts = 4
+
+var webhookBackoff = time.Second
+
+var webhookClient = &http.Client{Timeout: time.Second * 5}
+
+// watchThresholds checks rules against the statistics of each event until
+// events is closed, and sends an Alert when a rule that did not hold starts
+// to. A rule fires once while it keeps holding, and again only after it has
+// stopped holding in between. No rule holds while the window is empty.
+func watchThresholds(events <-chan StatsEvent, rules []ThresholdRule) {
+	firing := make([]bool, len(rules))
+	for event := range events {
+		stats := event.Stats
+		stats.derive()
+		for i, rule := range rules {
+			holds := stats.Count > 0 && rule.holds(stats)
+			if holds && !firing[i] {
+				go sendAlert(Alert{Rule: rule, Time: event.Time, Stats: stats})
+			}
+			firing[i] = holds
+		}
+	}
+}
+
+func sendAlert(alert Alert) {
+	body, _ := json.Marshal(alert)
+
+	wait := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := postAlert(body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			log.Printf("webhook: giving up on %s: %v", alert.Rule, err)
+			return
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// postAlert sends body to config.WebhookURL. Its errors leave out the URL,
+// which often carries a token.
+func postAlert(body []byte) error {
+	resp, err := webhookClient.Post(config.WebhookURL, "application/json", bytes.NewReader(body))
+	if urlErr := new(url.Error); errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
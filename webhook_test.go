@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	previous := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = previous })
+
+	// The receiver fails the first attempt at each alert and records the
+	// rest.
+	var lock sync.Mutex
+	attempts := 0
+	type received struct {
+		Rule  string `json:"rule"`
+		Stats Stats  `json:"stats"`
+	}
+	alerts := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts++
+		failed := attempts%2 == 1
+		lock.Unlock()
+		if failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var alert received
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		alerts <- alert
+	}))
+	defer receiver.Close()
+
+	setup(t, "WEBHOOK_URL="+receiver.URL, "WEBHOOK_RULES=count>=2")
+	events, unsubscribe := statsEvents.subscribe(64)
+	defer unsubscribe()
+	go watchThresholds(events, config.WebhookRules)
+
+	expect := func(count int) {
+		t.Helper()
+		select {
+		case alert := <-alerts:
+			if alert.Rule != "count>=2" || alert.Stats.Count != count {
+				t.Errorf("alert %s with count %d, want count>=2 with %d", alert.Rule, alert.Stats.Count, count)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no alert")
+		}
+	}
+
+	// Fires as the rule starts to hold, and not again while it does.
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("10", testStart), http.StatusCreated)
+	expect(2)
+	post(t, tx("10", testStart), http.StatusCreated)
+
+	// A reset clears it, so holding again fires again.
+	reset(t)
+	post(t, tx("10", testStart), http.StatusCreated)
+	post(t, tx("10", testStart), http.StatusCreated)
+	expect(2)
+
+	select {
+	case alert := <-alerts:
+		t.Errorf("another alert with count %d", alert.Stats.Count)
+	case <-time.After(50 * time.Millisecond):
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if attempts != 4 {
+		t.Errorf("%d attempts, want each of the two alerts retried once", attempts)
+	}
+}
+
+func TestParseThresholdRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want ThresholdRule
+		ok   bool
+	}{
+		{"avg>100", ThresholdRule{"avg", ">", 100}, true},
+		{"count>=50", ThresholdRule{"count", ">=", 50}, true},
+		{"min<=-2.5", ThresholdRule{"min", "<=", -2.5}, true},
+		{"sum<1e3", ThresholdRule{"sum", "<", 1000}, true},
+		{"mean>100", ThresholdRule{}, false},
+		{"AVG>100", ThresholdRule{}, false},
+		{"avg=100", ThresholdRule{}, false},
+		{"avg=>100", ThresholdRule{}, false},
+		{"avg!=100", ThresholdRule{}, false},
+		{"avg>", ThresholdRule{}, false},
+		{"avg> 100", ThresholdRule{}, false},
+		{"avg>ten", ThresholdRule{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseThresholdRule(tt.rule)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseThresholdRule(%q) = %+v, %v, want %+v, %v", tt.rule, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInvalidWebhookRules(t *testing.T) {
+	for _, env := range []string{"WEBHOOK_RULES=avg>100,median>5", "WEBHOOK_RULES=avg~100"} {
+		t.Run(env, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s was accepted", env)
+				}
+			}()
+			setup(t, "WEBHOOK_URL=http://127.0.0.1/", env)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWindowConfig(t *testing.T) {
+	tc := setup(t, "API_KEY=secret")
+	post(t, tx("10", testStart), http.StatusCreated)
+	tc.advance(40 * time.Second)
+	post(t, tx("20", tc.time()), http.StatusCreated)
+
+	// Shrinking to 30s evicts the first transaction straight away. The
+	// running statistics, as ever, only empty a window after the last write,
+	// but the views built from the queue lose it at once.
+	if w := request(t, http.MethodPut, "/admin/config/window", `{"window":"30s"}`, "X-API-Key: secret"); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if statsWindow() != 30*time.Second {
+		t.Errorf("window %v, want 30s", statsWindow())
+	}
+	if len(statsCache.queue) != 1 || statsCache.queue[0].Amount != 20 {
+		t.Errorf("%d queued, want only the transaction 10s old", len(statsCache.queue))
+	}
+	if stats := getStats(t, "/statistics?source=192.0.2.1"); stats.Count != 1 || stats.Sum != 20 || stats.WindowSeconds != 30 {
+		t.Errorf("%+v, want the one transaction within 30s", stats)
+	}
+
+	// Growing it again does not bring the first back.
+	if w := request(t, http.MethodPut, "/admin/config/window", `{"window":"1m"}`, "X-API-Key: secret"); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if stats := getStats(t, "/statistics?source=192.0.2.1"); stats.Count != 1 {
+		t.Errorf("count %d after growing the window, want 1", stats.Count)
+	}
+}
+
+func TestWindowConfigValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"window":"24h"}`, http.StatusNoContent},
+		{`{"window":"1ns"}`, http.StatusNoContent},
+		{`{"window":"24h0m1s"}`, http.StatusUnprocessableEntity},
+		{`{"window":"0s"}`, http.StatusUnprocessableEntity},
+		{`{"window":"-1m"}`, http.StatusUnprocessableEntity},
+		{`{"window":"a minute"}`, http.StatusUnprocessableEntity},
+		{`{}`, http.StatusUnprocessableEntity},
+		{`{"window":60}`, http.StatusBadRequest},
+		{`{"window":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			setup(t, "API_KEY=secret")
+			w := request(t, http.MethodPut, "/admin/config/window", tt.body, "X-API-Key: secret")
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if w.Code != http.StatusNoContent && statsWindow() != time.Minute {
+				t.Errorf("window changed to %v by a refused request", statsWindow())
+			}
+		})
+	}
+}
+
+func TestWindowConfigRequiresAPIKey(t *testing.T) {
+	setup(t)
+	if w := request(t, http.MethodPut, "/admin/config/window", `{"window":"30s"}`); w.Code != http.StatusForbidden {
+		t.Errorf("admin API disabled: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	setup(t, "API_KEY=secret")
+	for _, key := range []string{"", "X-API-Key: wrong"} {
+		var headers []string
+		if key != "" {
+			headers = append(headers, key)
+		}
+		if w := request(t, http.MethodPut, "/admin/config/window", `{"window":"30s"}`, headers...); w.Code != http.StatusUnauthorized {
+			t.Errorf("%q: status %d, want %d", key, w.Code, http.StatusUnauthorized)
+		}
+	}
+	if statsWindow() != time.Minute {
+		t.Errorf("window changed to %v without the key", statsWindow())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "sync"
+
+// WorkerPool applies transactions to statsCache on config.Workers
+// goroutines, so that transactionsHandler can answer 202 without waiting for
+// the write lock. The queue is bounded at config.WorkerQueue and a full queue
+// is reported to the client rather than waited on.
+type WorkerPool struct {
+	lock    sync.RWMutex
+	queue   chan *Transaction
+	stopped bool
+	done    sync.WaitGroup
+}
+
+var workerPool WorkerPool
+
+func (p *WorkerPool) start(workers, size int) {
+	p.queue = make(chan *Transaction, size)
+	p.stopped = false
+	for range workers {
+		p.done.Add(1)
+		go p.work()
+	}
+}
+
+// offer queues t, reporting false if the queue is full or the pool has
+// stopped.
+func (p *WorkerPool) offer(t *Transaction) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.stopped {
+		return false
+	}
+	select {
+	case p.queue <- t:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop waits for the queued transactions to be applied. Offers made once it
+// has been called are refused, so a handler that outlived the server's
+// shutdown cannot queue behind it.
+func (p *WorkerPool) stop() {
+	p.lock.Lock()
+	if p.queue == nil || p.stopped {
+		p.lock.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.queue)
+	p.lock.Unlock()
+	p.done.Wait()
+}
+
+// work applies queued transactions as transactionsHandler would have,
+// dropping those that a reset overtook or that no longer fit.
+func (p *WorkerPool) work() {
+	defer p.done.Done()
+
+	for t := range p.queue {
+		statsCache.lock.Lock()
+		now := clock()
+		if t.generation != statsCache.generation.Load() {
+			logCorrelated(t.correlationID, "worker: dropped a transaction overtaken by a reset")
+			asyncStatuses.finish(t.asyncID, asyncDropped, "Overtaken by a reset")
+		} else if t.expired(now) {
+			logCorrelated(t.correlationID, "worker: dropped a transaction that expired while queued")
+			asyncStatuses.finish(t.asyncID, asyncDropped, "Expired while queued")
+		} else if _, problem := statsCache.admit(t, now); problem != "" {
+			logCorrelated(t.correlationID, "worker: dropped a transaction: %s", problem)
+			asyncStatuses.finish(t.asyncID, asyncDropped, problem)
+		} else {
+			statsCache.accept(t, now)
+			asyncStatuses.finish(t.asyncID, asyncProcessed, "")
+		}
+		statsCache.lock.Unlock()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerQueueFull(t *testing.T) {
+	setup(t, "WORKERS=1", "WORKER_QUEUE=1")
+	workerPool.start(config.Workers, config.WorkerQueue)
+
+	// The worker blocks on the write lock with at most one transaction, so
+	// the queue holding another is full by the third.
+	statsCache.lock.Lock()
+	accepted := 0
+	var full *httptest.ResponseRecorder
+	for range 3 {
+		w := request(t, http.MethodPost, "/transactions", tx("10", testStart))
+		if w.Code == http.StatusAccepted {
+			accepted++
+			continue
+		}
+		full = w
+		break
+	}
+	statsCache.lock.Unlock()
+
+	if full == nil {
+		t.Fatal("three transactions were queued behind a blocked worker")
+	}
+	if full.Code != http.StatusServiceUnavailable || full.Header().Get("Retry-After") != "1" {
+		t.Errorf("full queue: status %d and Retry-After %q, want %d and 1", full.Code, full.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+
+	// Stopping drains what was queued and refuses anything later.
+	workerPool.stop()
+	if stats := getStats(t, "/statistics"); stats.Count != accepted {
+		t.Errorf("count %d after draining, want the %d accepted", stats.Count, accepted)
+	}
+	if w := request(t, http.MethodPost, "/transactions", tx("10", testStart)); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("after stopping: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func BenchmarkWriteWorkers(b *testing.B) {
+	for _, workers := range []int{0, 4} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			tc := setup(b, "WORKERS="+strconv.Itoa(workers), "WORKER_QUEUE=1024", "WINDOW=10s")
+			if workers > 0 {
+				workerPool.start(config.Workers, config.WorkerQueue)
+			}
+			want := http.StatusCreated
+			if workers > 0 {
+				want = http.StatusAccepted
+			}
+			handler := newHandler()
+			b.ResetTimer()
+			for range b.N {
+				// The window is wide enough that nothing expires while the
+				// queue falls behind.
+				tc.advance(time.Millisecond)
+				body := tx("10", tc.time())
+				for {
+					r := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body))
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, r)
+					if w.Code == want {
+						break
+					}
+					if w.Code != http.StatusServiceUnavailable {
+						b.Fatalf("status %d: %s", w.Code, w.Body)
+					}
+				}
+			}
+			// The queued transactions count towards the time taken.
+			workerPool.stop()
+		})
+	}
+}